@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/metronome-industries/quikstrate/internal/creds"
 	"github.com/spf13/cobra"
 )
@@ -9,13 +11,44 @@ var accountsCmd = &cobra.Command{
 	Use:   "accounts",
 	Short: "Caches and returns the results of the 'substrate accounts' command.",
 	Long: `The quikstrate accounts default output is slightly different from substrate.  Extraneous information 
-like the account email and Administrator role ARN are removed in favor of the gnome.house console URL and AWS_PROFILE snippet.
+like the account email and Administrator role ARN are removed in favor of the console URL (console.account_url in the config) and AWS_PROFILE snippet.
+
+The account list is cached for accounts_ttl (24h by default, see "quikstrate config"), --refresh fetches it now.  Any
+accounts added, removed or retagged since the previous list are logged.
+
+Only ACTIVE accounts with a known Environment tag are listed by default, in every format.  Narrow the list with --env,
+--domain, --quality, --tag key=value and --status (or "--status all"), or --search the name, ID, email and tags, eg.
+
+	quikstrate accounts -e prod --search billing
+	quikstrate accounts --include-unmanaged --status all
+	quikstrate accounts -f markdown
+	quikstrate accounts --template '{{.Id}} {{.Profile}} {{.Tags.Quality}} {{.ConsoleURL}}'
+
+AWS console switch-role URLs (the environment's default_role, displayed as the AWS_PROFILE in the environment's
+color, on console.switch_role_url) are available as {{.SwitchRoleURL}}, and --export writes them for every listed
+account.  --export only reads the cached account list (however old), add --refresh to fetch it first:
+
+	quikstrate accounts --template '{{.SwitchRoleName}} {{.SwitchRoleURL}}'
+	quikstrate accounts --export extend-switch-roles   # paste into the AWS Extend Switch Roles extension
+	quikstrate accounts --export bookmarks > aws.html  # import into any browser
 
 If other information would be helpful here we can surface it!`,
 	Run: creds.AccountsCmd,
 }
 
 func init() {
-	accountsCmd.Flags().StringP("format", "f", "text", "output format")
+	addOutputFlags(accountsCmd, "text")
+	accountsCmd.Flags().String("export", "", "write the accounts' switch-role links instead, one of: "+strings.Join(creds.AccountExports, ", "))
+	accountsCmd.Flags().Bool("refresh", false, "fetch the account list from substrate, ignoring the cache")
+	accountsCmd.Flags().StringP("env", "e", "", "only accounts in this environment")
+	accountsCmd.Flags().StringP("domain", "d", "", "only accounts in this domain")
+	accountsCmd.Flags().StringP("quality", "q", "", "only accounts with this quality")
+	accountsCmd.Flags().StringArray("tag", nil, "only accounts with this tag, key=value (repeatable)")
+	accountsCmd.Flags().String("status", "ACTIVE", "only accounts with this status, or \"all\"")
+	accountsCmd.Flags().StringP("search", "s", "", "fuzzy search the account name, ID, email and tags")
+	accountsCmd.Flags().Bool("include-unmanaged", false, "include accounts without a known Environment tag (management, audit, network)")
+	accountsCmd.RegisterFlagCompletionFunc("env", creds.CompleteEnvironments)
+	accountsCmd.RegisterFlagCompletionFunc("domain", creds.CompleteDomains)
+	accountsCmd.RegisterFlagCompletionFunc("quality", creds.CompleteQualities)
 	rootCmd.AddCommand(accountsCmd)
 }
@@ -1,31 +1,56 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/metronome-industries/quikstrate/internal/creds"
 	"github.com/spf13/cobra"
 )
 
 var assumeCmd = &cobra.Command{
-	Use:   "assume",
+	Use:   "assume [profile]",
 	Short: "A stripped down version of the 'substrate assume-role' command.",
 	Long: `This command uses the default credentials to fetch and cache role specific credentials.  This is used extensively in ~/.aws/config profiles (and 
 kubectl through that).  The --env, --domain, --quality, and --role flags specify which credentials, and --format specifies the output.
+Environments may be given by alias (prd, production, stg), and instead of --env/--domain a profile can be given as the
+argument, either an AWS_PROFILE name or a path with the quality and role optional:
+
+	quikstrate assume prod-api
+	quikstrate assume prd/api/gamma/Auditor
 
 Similarly to "quikstrate credentials", the --force flag will always fetch new credentials.
 
-Note that role-specific credentials expire in 1 hour, not 12 hours like the default credentials. Just an FYI, nothing to worry about.`,
-	Run:    creds.AssumeCmd,
-	PreRun: creds.PreRunCmd,
+The --native flag (or QUIKSTRATE_NATIVE_ASSUME=true) calls sts:AssumeRole directly with the default credentials,
+resolving the role ARN (in the account's partition, eg. aws-us-gov) from the cached account list, instead of running
+"substrate assume-role".  It falls back to
+substrate on any failure.  QUIKSTRATE_STS_ENDPOINT overrides the STS endpoint.
+
+Note that role-specific credentials expire in 1 hour, not 12 hours like the default credentials. Just an FYI, nothing to worry about.
+
+The shell used by "-f export" is, in order: --shell, $QUIKSTRATE_SHELL, the nearest shell in the parent process tree
+(skipping go run, sudo, env and similar wrappers), $SHELL, and finally POSIX sh syntax.  Supported shells are
+sh/bash/zsh, fish, nu, pwsh and csh/tcsh (dash, ash, ksh and mksh get sh syntax), an unknown --shell is an error.`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: creds.CompleteProfiles,
+	Run:               creds.AssumeCmd,
+	PreRun:            creds.PreRunCmd,
 }
 
 func init() {
 	assumeCmd.Flags().StringP("env", "e", "", "substrate environment")
 	assumeCmd.Flags().StringP("domain", "d", "", "substrate domain")
 	assumeCmd.Flags().StringP("quality", "q", "", "substrate quality")
-	assumeCmd.Flags().StringP("role", "r", "Administrator", "substrate role")
-	assumeCmd.Flags().StringP("format", "f", "export", "substrate environment")
+	assumeCmd.Flags().StringP("role", "r", "", "substrate role (defaults to the environment's default_role, eg. Auditor in prod)")
+	assumeCmd.Flags().Bool("break-glass", false, "approve a privileged role (eg. prod Administrator), requires --reason")
+	assumeCmd.Flags().String("reason", "", "why the privileged role is needed, recorded with the break-glass approval")
+	assumeCmd.Flags().Bool("no-prompt", false, "fail (exit code 5) instead of asking to confirm a privileged role at the terminal")
+	assumeCmd.Flags().StringP("format", "f", "export", "output format, one of: "+strings.Join(creds.CredentialFormats, ", "))
+	assumeCmd.Flags().String("region", "", "include AWS_REGION (and AWS_DEFAULT_REGION) in the output")
 	assumeCmd.Flags().Bool("force", false, "always fetch new credentials")
-	assumeCmd.MarkFlagRequired("env")
-	assumeCmd.MarkFlagRequired("domain")
+	assumeCmd.Flags().Bool("native", false, "assume the role with sts directly instead of substrate")
+	assumeCmd.Flags().String("shell", "", "shell syntax for export (bash, zsh, fish, nu, pwsh, tcsh), detected when unset")
+	assumeCmd.RegisterFlagCompletionFunc("env", creds.CompleteEnvironments)
+	assumeCmd.RegisterFlagCompletionFunc("domain", creds.CompleteDomains)
+	assumeCmd.RegisterFlagCompletionFunc("quality", creds.CompleteQualities)
 	rootCmd.AddCommand(assumeCmd)
 }
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"github.com/metronome-industries/quikstrate/internal/creds"
+	"github.com/spf13/cobra"
+)
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Queries the local log of credential requests",
+	Long: `Every credential fetched from substrate (miss), and every privileged role served from the cache (hit), is
+appended to ~/.quikstrate/audit.jsonl with the role, expiry, calling process and its command line, and any
+break-glass reason.  The log is rotated to audit.jsonl.1 at 10MiB (QUIKSTRATE_AUDIT_MAX_SIZE bytes), both are
+queried and "quikstrate clean" keeps both.
+
+	quikstrate audit --since 24h --env prod --role Administrator
+	quikstrate audit --since 2024-01-02T00:00:00Z --until 2024-01-03T00:00:00Z -f json`,
+	Run:    creds.AuditCmd,
+	PreRun: creds.PreRunCmd,
+}
+
+func init() {
+	addOutputFlags(auditCmd, "text")
+	auditCmd.Flags().String("since", "", "only records after this time, a duration ago (24h) or RFC3339")
+	auditCmd.Flags().String("until", "", "only records before this time, a duration ago (1h) or RFC3339")
+	auditCmd.Flags().StringP("env", "e", "", "only records for this environment")
+	auditCmd.Flags().StringP("domain", "d", "", "only records for this domain")
+	auditCmd.Flags().StringP("role", "r", "", "only records for this role")
+	auditCmd.Flags().String("cache", "", "only cache hits (hit) or misses (miss)")
+	auditCmd.RegisterFlagCompletionFunc("env", creds.CompleteEnvironments)
+	auditCmd.RegisterFlagCompletionFunc("domain", creds.CompleteDomains)
+	rootCmd.AddCommand(auditCmd)
+}
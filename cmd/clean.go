@@ -4,7 +4,7 @@ Copyright © 2023 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
-	"os"
+	"log"
 
 	"github.com/metronome-industries/quikstrate/internal/creds"
 	"github.com/spf13/cobra"
@@ -13,8 +13,12 @@ import (
 var cleanCmd = &cobra.Command{
 	Use:   "clean",
 	Short: "Removes all quikstrate caches.",
+	Long: `Removes everything in ~/.quikstrate except config.yaml, including the cache encryption key
+(QUIKSTRATE_CACHE_KEY_FILE) when the encrypted cache backend is in use.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		os.RemoveAll(creds.CredsDir)
+		if err := creds.CleanCache(); err != nil {
+			log.Fatal(err)
+		}
 	},
 }
 
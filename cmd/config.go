@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"github.com/metronome-industries/quikstrate/internal/creds"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the quikstrate config",
+	Long: `quikstrate reads ~/.quikstrate/config.yaml ($QUIKSTRATE_CONFIG), then the nearest .quikstrate.yaml in the
+working directory or its parents, on top of the compiled-in defaults.  Environments are merged by name, any
+other setting replaces the one before it.  policy, console and the environments' aliases, default_quality and
+default_role are only read from ~/.quikstrate/config.yaml, a .quikstrate.yaml that sets them is an error.  An alias
+may not name another environment (or be another environment's alias).  The console federation_url,
+destination_url and switch_role_url must be https (or http to localhost):
+
+	region: us-west-2
+	accounts_ttl: 24h
+	environments:
+	  prod:
+	    aliases: [production, prod, prd]
+	    default_quality: gamma
+	    default_role: Auditor
+	    color: f2b0a9
+	domains: [api, auth, graphql]
+	special_domains: [audit, deploy, network]
+	clusters:
+	  - name: graphql
+	    domain: graphql
+	eks:
+	  deny: ["*-sandbox"]
+	policy:
+	  privileged:
+	    - environment: prod
+	      role: Administrator
+	  cache_lifetime: 15m
+	  approval_lifetime: 1h
+	console:
+	  account_url: "https://gnome.house/accounts?number={{.AccountId}}&role={{.Role}}"
+	  federation_url: https://signin.aws.amazon.com/federation
+	  destination_url: https://console.aws.amazon.com/
+	  switch_role_url: https://signin.aws.amazon.com/switchrole
+	drift:
+	  skip_patterns: [confluent]`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Prints the effective config, the defaults merged with any config files",
+	Run:   creds.ConfigShowCmd,
+}
+
+func init() {
+	addOutputFlags(configShowCmd, "yaml")
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
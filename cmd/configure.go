@@ -16,12 +16,20 @@ var configureCmd = &cobra.Command{
 		- creates a profile for each environment and domain
 		- sets the region for each profile to "us-west-2" (configurable)
 		- sets the credential_process for each profile to this tool, allowing you to easily use cached credentials
+		- each profile assumes the environment's default role (Auditor in prod, Administrator in staging)
 		- set the profile by:
 			- setting the AWS_PROFILE environment variable
 			- using the --profile flag on the aws-cli
 	kubectl:
 		- creates a context for each cluster
 		- uses the "aws eks update-kubeconfig" command to set the correct AWS_PROFILE for each context
+
+	--discover builds the environment/domain/quality matrix from the substrate account list (quikstrate accounts)
+	instead of the configured domains, so new substrate domains are configured without a quikstrate release.
+
+	--discover-clusters lists the EKS clusters in each account (with the environment's default role) instead of
+	using the configured clusters.  --cluster-allow and --cluster-deny filter contexts by name, eg. "prod-*".
+	QUIKSTRATE_EKS_ENDPOINT overrides the EKS endpoint.
 	`,
 	Run:    creds.ConfigureCmd,
 	PreRun: creds.PreRunCmd,
@@ -32,7 +40,11 @@ func init() {
 	configureCmd.Flags().Bool("check", false, "checks if this command has been run before")
 	configureCmd.Flags().BoolP("dryrun", "d", false, "removes existing config files before configuring")
 	configureCmd.MarkFlagsMutuallyExclusive("clean", "dryrun", "check")
-	configureCmd.Flags().String("aws-region", "us-west-2", "aws region to configure")
+	configureCmd.Flags().Bool("discover", false, "configure every environment, domain and quality in the substrate account list")
+	configureCmd.Flags().Bool("discover-clusters", false, "configure every EKS cluster found in each account")
+	configureCmd.Flags().StringArray("cluster-allow", creds.Settings.EKS.Allow, "only configure kube contexts matching these globs")
+	configureCmd.Flags().StringArray("cluster-deny", creds.Settings.EKS.Deny, "never configure kube contexts matching these globs")
+	configureCmd.Flags().String("aws-region", creds.DefaultRegion, "aws region to configure")
 	var defaultEnvs []string
 	for _, env := range creds.EnvironmentMap {
 		defaultEnvs = append(defaultEnvs, env.Name)
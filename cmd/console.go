@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"github.com/metronome-industries/quikstrate/internal/creds"
+	"github.com/spf13/cobra"
+)
+
+var consoleCmd = &cobra.Command{
+	Use:   "console [profile]",
+	Short: "Prints (or opens) an AWS console sign-in URL for a role",
+	Long: `This command exchanges the cached role credentials for a federation sign-in token and prints a URL that logs
+straight into the AWS console as that role.  The role is chosen as with "quikstrate assume", by --env/--domain or a profile:
+
+	quikstrate console prod-api --service s3
+	quikstrate console stg/api --service "cloudwatch/home#logsV2:log-groups" --region us-east-1 --open
+
+--service is a console service (s3, ec2, eks) or a path within the console, and --region defaults to the region setting.
+The sign-in URL is valid for 15 minutes and the console session lasts as long as the role credentials.
+
+The federation endpoint is the console.federation_url setting (QUIKSTRATE_FEDERATION_ENDPOINT changes its default).`,
+	Args:              cobra.MaximumNArgs(1),
+	ValidArgsFunction: creds.CompleteProfiles,
+	Run:               creds.ConsoleCmd,
+	PreRun:            creds.PreRunCmd,
+}
+
+func init() {
+	consoleCmd.Flags().StringP("env", "e", "", "substrate environment")
+	consoleCmd.Flags().StringP("domain", "d", "", "substrate domain")
+	consoleCmd.Flags().StringP("quality", "q", "", "substrate quality")
+	consoleCmd.Flags().StringP("role", "r", "", "substrate role (defaults to the environment's default_role, eg. Auditor in prod)")
+	consoleCmd.Flags().Bool("break-glass", false, "approve a privileged role (eg. prod Administrator), requires --reason")
+	consoleCmd.Flags().String("reason", "", "why the privileged role is needed, recorded with the break-glass approval")
+	consoleCmd.Flags().StringP("service", "s", "", "console service or path to open, eg. s3 or cloudwatch/home#logsV2:log-groups")
+	consoleCmd.Flags().String("region", "", "console region, defaults to the region setting")
+	consoleCmd.Flags().Bool("open", false, "open the URL in a browser instead of printing it")
+	consoleCmd.RegisterFlagCompletionFunc("env", creds.CompleteEnvironments)
+	consoleCmd.RegisterFlagCompletionFunc("domain", creds.CompleteDomains)
+	consoleCmd.RegisterFlagCompletionFunc("quality", creds.CompleteQualities)
+	rootCmd.AddCommand(consoleCmd)
+}
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"strings"
+
 	"github.com/metronome-industries/quikstrate/internal/creds"
 	"github.com/spf13/cobra"
 )
@@ -12,15 +14,21 @@ var credentialsCmd = &cobra.Command{
 The only difference in usage is the "--force" flag, which will make quikstrate fetch and cache new credentials everytime.
 
 It's recommended to add the following alias to your shell profile (eg. ~/.zshrc):
-alias creds="eval \$(quikstrate credentials)"`,
+alias creds="eval \$(quikstrate credentials)"
+
+The shell used by "-f export" is, in order: --shell, $QUIKSTRATE_SHELL, the nearest shell in the parent process tree
+(skipping go run, sudo, env and similar wrappers), $SHELL, and finally POSIX sh syntax.  Supported shells are
+sh/bash/zsh, fish, nu, pwsh and csh/tcsh (dash, ash, ksh and mksh get sh syntax), an unknown --shell is an error.`,
 	Run:    creds.CredentialsCmd,
 	PreRun: creds.PreRunCmd,
 }
 
 func init() {
-	credentialsCmd.Flags().StringP("format", "f", "export", "substrate environment")
+	credentialsCmd.Flags().StringP("format", "f", "export", "output format, one of: "+strings.Join(creds.CredentialFormats, ", "))
+	credentialsCmd.Flags().String("region", "", "include AWS_REGION (and AWS_DEFAULT_REGION) in the output")
 	credentialsCmd.Flags().Bool("force", false, "always fetch new credentials")
 	credentialsCmd.Flags().Bool("check", false, "check if credentials are expired, exit 0 if up-to-date otherwise exit 1`")
+	credentialsCmd.Flags().String("shell", "", "shell syntax for export (bash, zsh, fish, nu, pwsh, tcsh), detected when unset")
 	credentialsCmd.MarkFlagsMutuallyExclusive("force", "check")
 	rootCmd.AddCommand(credentialsCmd)
 }
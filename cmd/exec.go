@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/metronome-industries/quikstrate/internal/creds"
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec -e <env> -d <domain> [flags] -- <command> [args...]",
+	Short: "Runs a command with role credentials injected into its environment",
+	Long: `Fetches (or reuses cached) role credentials like "quikstrate assume" and runs the command with AWS_ACCESS_KEY_ID,
+AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, AWS_REGION and QUIKSTRATE_PROFILE set.  AWS_PROFILE is removed so it can't
+shadow the injected credentials, and the credentials never touch the parent shell.
+
+The command's exit code is passed through, eg.
+	quikstrate exec -e prod -d api -r Auditor -- terraform plan`,
+	Args:   cobra.MinimumNArgs(1),
+	Run:    creds.ExecCmd,
+	PreRun: creds.PreRunCmd,
+}
+
+func init() {
+	execCmd.Flags().StringP("env", "e", "", "substrate environment")
+	execCmd.Flags().StringP("domain", "d", "", "substrate domain")
+	execCmd.Flags().StringP("quality", "q", "", "substrate quality")
+	execCmd.Flags().StringP("role", "r", "", "substrate role (defaults to the environment's default_role, eg. Auditor in prod)")
+	execCmd.Flags().Bool("break-glass", false, "approve a privileged role (eg. prod Administrator), requires --reason")
+	execCmd.Flags().String("reason", "", "why the privileged role is needed, recorded with the break-glass approval")
+	execCmd.Flags().String("region", creds.DefaultRegion, "aws region")
+	execCmd.Flags().Bool("force", false, "always fetch new credentials")
+	execCmd.MarkFlagRequired("env")
+	execCmd.MarkFlagRequired("domain")
+	// everything after the command belongs to the command
+	execCmd.Flags().SetInterspersed(false)
+	execCmd.RegisterFlagCompletionFunc("env", creds.CompleteEnvironments)
+	execCmd.RegisterFlagCompletionFunc("domain", creds.CompleteDomains)
+	execCmd.RegisterFlagCompletionFunc("quality", creds.CompleteQualities)
+	rootCmd.AddCommand(execCmd)
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"github.com/metronome-industries/quikstrate/internal/creds"
+	"github.com/spf13/cobra"
+)
+
+var imdsCmd = &cobra.Command{
+	Use:   "imds",
+	Short: "Emulates the EC2 instance metadata service (IMDSv2) for a role",
+	Long: `Runs an IMDSv2 compatible endpoint that hands out the cached credentials for --env/--domain/--quality/--role,
+so tools that only know the EC2 instance metadata provider can run locally.  Point them at it with:
+
+	AWS_EC2_METADATA_SERVICE_ENDPOINT=http://127.0.0.1:1338
+
+Supported paths: PUT /latest/api/token, /latest/meta-data/iam/security-credentials/<role>, /latest/meta-data/iam/info,
+/latest/dynamic/instance-identity/document, /latest/meta-data/instance-id and /latest/meta-data/placement/*.`,
+	Run:    creds.ImdsCmd,
+	PreRun: creds.PreRunCmd,
+}
+
+func init() {
+	imdsCmd.Flags().StringP("env", "e", "", "substrate environment")
+	imdsCmd.Flags().StringP("domain", "d", "", "substrate domain")
+	imdsCmd.Flags().StringP("quality", "q", "", "substrate quality")
+	imdsCmd.Flags().StringP("role", "r", "", "substrate role (defaults to the environment's default_role, eg. Auditor in prod)")
+	imdsCmd.Flags().Bool("break-glass", false, "approve a privileged role (eg. prod Administrator), requires --reason")
+	imdsCmd.Flags().String("reason", "", "why the privileged role is needed, recorded with the break-glass approval")
+	imdsCmd.Flags().String("addr", "127.0.0.1:1338", "address to listen on")
+	imdsCmd.Flags().String("region", creds.DefaultRegion, "region reported by the identity document")
+	imdsCmd.MarkFlagRequired("env")
+	imdsCmd.MarkFlagRequired("domain")
+	rootCmd.AddCommand(imdsCmd)
+}
@@ -3,16 +3,23 @@ package cmd
 import (
 	"log"
 	"os"
+	"strings"
 
+	"github.com/metronome-industries/quikstrate/internal/creds"
 	"github.com/spf13/cobra"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "quikstrate -h",
 	Short: "A substrate wrapper",
-	CompletionOptions: cobra.CompletionOptions{
-		DisableDefaultCmd: true,
-	},
+	Long: `A substrate wrapper.
+
+Exit codes:
+	1	general error
+	3	substrate is waiting for an interactive login (the login URL is printed to stderr)
+	4	substrate timed out (--substrate-timeout)
+	5	a privileged role needs a --break-glass approval`,
+	PersistentPreRun: creds.RootPreRunCmd,
 }
 
 func Execute() {
@@ -24,4 +31,13 @@ func Execute() {
 
 func init() {
 	log.SetFlags(0)
+	rootCmd.PersistentFlags().Duration("substrate-timeout", creds.DefaultSubstrateOptions.Timeout, "timeout for each substrate call ($QUIKSTRATE_SUBSTRATE_TIMEOUT)")
+	rootCmd.PersistentFlags().Int("substrate-retries", creds.DefaultSubstrateOptions.Retries, "retries for failed substrate calls ($QUIKSTRATE_SUBSTRATE_RETRIES)")
+	rootCmd.PersistentFlags().String("substrate-binary", "", "path to the substrate binary (defaults to $QUIKSTRATE_SUBSTRATE_BINARY or \"substrate\")")
+}
+
+// addOutputFlags adds the --format and --template flags understood by creds.OutputFromFlags
+func addOutputFlags(cmd *cobra.Command, format string) {
+	cmd.Flags().StringP("format", "f", format, "output format, one of: "+strings.Join(creds.OutputFormats, ", "))
+	cmd.Flags().String("template", "", "Go template executed for each record instead of --format, eg. '{{.Id}} {{.Name}}'")
 }
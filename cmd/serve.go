@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"github.com/metronome-industries/quikstrate/internal/creds"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serves credentials over HTTP using the ECS container credentials protocol",
+	Long: `Runs a local credential server that keeps the default and role credentials in memory and refreshes
+them before they expire.  Point the AWS SDKs at it with:
+
+	AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:9911/creds                     # default credentials
+	AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:9911/role/prod/api?role=Auditor # role credentials
+	AWS_CONTAINER_AUTHORIZATION_TOKEN=<token>
+
+The token is generated on startup unless --token (or AWS_CONTAINER_AUTHORIZATION_TOKEN) is set.  The SDKs only
+accept http URIs on loopback addresses, so containers need host networking (or --addr on a reachable loopback).
+
+Set QUIKSTRATE_SUBSTRATE_BINARY to use a different substrate binary.`,
+	Run:    creds.ServeCmd,
+	PreRun: creds.PreRunCmd,
+}
+
+func init() {
+	serveCmd.Flags().String("addr", "127.0.0.1:9911", "address to listen on")
+	serveCmd.Flags().String("token", "", "authorization token clients must send (defaults to a random token)")
+	rootCmd.AddCommand(serveCmd)
+}
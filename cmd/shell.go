@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"github.com/metronome-industries/quikstrate/internal/creds"
+	"github.com/spf13/cobra"
+)
+
+var shellCmd = &cobra.Command{
+	Use:   "shell",
+	Short: "Opens a subshell with role credentials",
+	Long: `Opens a subshell (bash, zsh or fish, whichever you are running) with the credentials for --env/--domain set
+and the prompt prefixed with the profile, eg. "[prod-api]".  QUIKSTRATE_PROFILE and QUIKSTRATE_PROMPT are set for
+prompt themes that redraw the prompt themselves.
+
+Role credentials expire after an hour, so before a prompt (at most once a minute) the subshell re-runs "quikstrate assume"
+and evals its export, picking up fresh credentials once the cached ones are close to expiring.  Credentials are only
+ever passed through the environment and that pipe, never written to a file.  Exiting the subshell drops them entirely.
+The refresh never prompts: a privileged role confirmed at the terminal is recorded as an approval, and once the
+approval lapses (policy.approval_lifetime) the subshell stops refreshing and its credentials expire.
+
+The shell started is, in order: --shell, $QUIKSTRATE_SHELL, the nearest shell in the parent process tree
+(skipping go run, sudo, env and similar wrappers), $SHELL, and finally sh.`,
+	Run:    creds.ShellCmd,
+	PreRun: creds.PreRunCmd,
+}
+
+func init() {
+	shellCmd.Flags().StringP("env", "e", "", "substrate environment")
+	shellCmd.Flags().StringP("domain", "d", "", "substrate domain")
+	shellCmd.Flags().StringP("quality", "q", "", "substrate quality")
+	shellCmd.Flags().StringP("role", "r", "", "substrate role (defaults to the environment's default_role, eg. Auditor in prod)")
+	shellCmd.Flags().Bool("break-glass", false, "approve a privileged role (eg. prod Administrator), requires --reason")
+	shellCmd.Flags().String("reason", "", "why the privileged role is needed, recorded with the break-glass approval")
+	shellCmd.Flags().String("region", creds.DefaultRegion, "aws region")
+	shellCmd.Flags().Bool("force", false, "always fetch new credentials")
+	shellCmd.Flags().String("shell", "", "shell to start (bash, zsh, fish), detected when unset")
+	shellCmd.MarkFlagRequired("env")
+	shellCmd.MarkFlagRequired("domain")
+	shellCmd.RegisterFlagCompletionFunc("env", creds.CompleteEnvironments)
+	shellCmd.RegisterFlagCompletionFunc("domain", creds.CompleteDomains)
+	shellCmd.RegisterFlagCompletionFunc("quality", creds.CompleteQualities)
+	rootCmd.AddCommand(shellCmd)
+}
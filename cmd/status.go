@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/metronome-industries/quikstrate/internal/creds"
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Lists every cached credential and when it expires",
+	Long: `Lists the default credentials, every role credential cache and the accounts cache in ~/.quikstrate, along
+with the time until each expires, whether the next call would fetch new credentials, and how old each file is.
+
+This is the first thing to check when quikstrate "isn't working".`,
+	Run: creds.StatusCmd,
+}
+
+func init() {
+	addOutputFlags(statusCmd, "text")
+	rootCmd.AddCommand(statusCmd)
+}
@@ -10,11 +10,15 @@ var whoamiCmd = &cobra.Command{
 	Short: "Returns the current user",
 	Long: `This simply merges the result of "aws sts get-caller-identity" with 
 the accounts information from substrate.  If this is not returning what you expect,
-double check your AWS_* environment variables.`,
+double check your AWS_* environment variables.
+
+Assumed roles (including IAM Identity Center permission sets), federated users, IAM users and root are all
+recognized.  The Source column shows where the credentials came from: env (AWS_ACCESS_KEY_ID), AWS_PROFILE,
+a container endpoint or the default profile, along with the quikstrate cache file holding them and when they expire.`,
 	Run: creds.WhoamiCmd,
 }
 
 func init() {
-	whoamiCmd.Flags().StringP("format", "f", "text", "output format")
+	addOutputFlags(whoamiCmd, "text")
 	rootCmd.AddCommand(whoamiCmd)
 }
@@ -1,14 +1,17 @@
 package creds
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/bitfield/script"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 )
@@ -16,24 +19,192 @@ import (
 var accountsFile = filepath.Join(CredsDir, "accounts.json")
 
 func AccountsCmd(cmd *cobra.Command, args []string) {
-	format := cmd.Flag("format").Value.String()
+	output, err := OutputFromFlags(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	refresh, _ := strconv.ParseBool(cmd.Flag("refresh").Value.String())
+	export := cmd.Flag("export").Value.String()
+	if export != "" && !slices.Contains(AccountExports, export) {
+		log.Fatalf("export %s is unsupported, expected one of %s", export, strings.Join(AccountExports, ", "))
+	}
 
-	accountList, err := getAccountList()
+	var accountList AccountList
+	switch {
+	case refresh:
+		accountList, err = forceRefreshAccounts()
+	case export != "":
+		// exports only build links, so they never call substrate (or AWS) unless asked to --refresh
+		if accountList, err = readAccountsFile(accountsFile); err != nil {
+			log.Fatalf("no cached account list to export (%s), add --refresh to fetch it", err)
+		}
+	default:
+		accountList, err = getAccountList()
+	}
 	if err != nil {
-		log.Fatal("Unable to retrieve account information:", err.Error())
+		exitOnError(fmt.Errorf("Unable to retrieve account information: %w", err))
+	}
+
+	filter, err := accountFilterFromFlags(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if export != "" {
+		if err := accountList.Filter(filter).Export(os.Stdout, export); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printOutput(output, accountList.Filter(filter))
+}
+
+// AccountFilter narrows the account list, empty fields match everything
+type AccountFilter struct {
+	Environment string
+	Domain      string
+	Quality     string
+	Tags        map[string]string
+	// Status matches case insensitively, "all" matches any status
+	Status string
+	// Search matches the name, ID, email or tags as a substring, or the name as a fuzzy subsequence
+	Search string
+	// IncludeUnmanaged keeps accounts without a known Environment tag, eg. management, audit and network
+	IncludeUnmanaged bool
+}
+
+func accountFilterFromFlags(cmd *cobra.Command) (AccountFilter, error) {
+	filter := AccountFilter{
+		Environment: cmd.Flag("env").Value.String(),
+		Domain:      cmd.Flag("domain").Value.String(),
+		Quality:     cmd.Flag("quality").Value.String(),
+		Tags:        map[string]string{},
+		Status:      cmd.Flag("status").Value.String(),
+		Search:      cmd.Flag("search").Value.String(),
+	}
+	filter.IncludeUnmanaged, _ = strconv.ParseBool(cmd.Flag("include-unmanaged").Value.String())
+	if env, ok := resolveEnvironment(filter.Environment); ok {
+		filter.Environment = env
+	}
+	tags, _ := cmd.Flags().GetStringArray("tag")
+	for _, tag := range tags {
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok || key == "" {
+			return filter, fmt.Errorf("invalid --tag %q, expected key=value", tag)
+		}
+		filter.Tags[key] = value
 	}
-	accountList.Print(format)
+	return filter, nil
 }
 
+// Filter returns the accounts matching filter, keeping the cache metadata
+func (a AccountList) Filter(filter AccountFilter) AccountList {
+	filtered := a
+	filtered.Accounts = nil
+	for _, account := range a.Accounts {
+		if filter.match(account) {
+			filtered.Accounts = append(filtered.Accounts, account)
+		}
+	}
+	return filtered
+}
+
+func (f AccountFilter) match(account Account) bool {
+	if _, managed := EnvironmentMap[account.Tags["Environment"]]; !managed && !f.IncludeUnmanaged {
+		return false
+	}
+	if f.Status != "" && !strings.EqualFold(f.Status, "all") && !strings.EqualFold(account.Status, f.Status) {
+		return false
+	}
+	if f.Environment != "" && account.Tags["Environment"] != f.Environment {
+		return false
+	}
+	if f.Domain != "" && account.Tags["Domain"] != f.Domain {
+		return false
+	}
+	if f.Quality != "" && account.Tags["Quality"] != f.Quality {
+		return false
+	}
+	for key, value := range f.Tags {
+		if account.Tags[key] != value {
+			return false
+		}
+	}
+	return f.Search == "" || account.search(f.Search)
+}
+
+func (a Account) search(query string) bool {
+	query = strings.ToLower(query)
+	fields := []string{a.Name, a.Id, a.Email}
+	for _, value := range a.Tags {
+		fields = append(fields, value)
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return fuzzyMatch(strings.ToLower(a.Name), query)
+}
+
+// fuzzyMatch is true when the characters of query appear in s in order, eg. "stst" in "static-sites"
+func fuzzyMatch(s, query string) bool {
+	want := []rune(query)
+	for _, r := range s {
+		if len(want) == 0 {
+			break
+		}
+		if r == want[0] {
+			want = want[1:]
+		}
+	}
+	return len(want) == 0
+}
+
+// getAccountList returns the cached account list, refreshing it once it is older than the accounts
+// TTL.  A stale list is still returned, with a warning, when substrate can't be reached.
 func getAccountList() (accountList AccountList, err error) {
 	accountList, err = readAccountsFile(accountsFile)
+	if err == nil && !accountList.stale() {
+		return
+	}
+
+	unlock, err := lockFile(accountsFile)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	// another process may have refreshed the file while we waited for the lock
+	cached, err := readAccountsFile(accountsFile)
+	if err == nil && !cached.stale() {
+		return cached, nil
+	}
 	if err != nil {
 		log.Print("unable to read cached accounts file, calling substrate...")
-		accountList, err = refreshAccounts(accountsFile)
+		return refreshAccounts(accountsFile)
+	}
+
+	log.Printf("cached accounts are older than %s, calling substrate...", accountsTTL)
+	accountList, err = refreshAccounts(accountsFile)
+	if err != nil {
+		log.Printf("unable to refresh accounts, using the cached list: %s", err)
+		return cached, nil
 	}
 	return
 }
 
+// forceRefreshAccounts replaces the cached account list with a fresh one from substrate
+func forceRefreshAccounts() (AccountList, error) {
+	unlock, err := lockFile(accountsFile)
+	if err != nil {
+		return AccountList{}, err
+	}
+	defer unlock()
+	return refreshAccounts(accountsFile)
+}
+
+// refreshAccounts expects the caller to hold the lock for file.  Changes since the previous
+// list are logged.
 func refreshAccounts(file string) (accountList AccountList, err error) {
 	defaultCreds, err := getDefaultCredentials()
 	if err != nil {
@@ -41,13 +212,18 @@ func refreshAccounts(file string) (accountList AccountList, err error) {
 	}
 	defaultCreds.SetEnv()
 
-	byteValue, err := script.NewPipe().WithStderr(os.Stderr).Exec("substrate account list --format json").Bytes()
+	ctx := context.TODO()
+	accountList.Accounts, err = substrate.AccountList(ctx)
 	if err != nil {
 		return
 	}
+	accountList.FetchedAt = time.Now().UTC()
+	if accountList.SubstrateVersion, err = substrate.Version(ctx); err != nil {
+		log.Printf("unable to get the substrate version: %s", err)
+	}
 
-	if err = json.Unmarshal(byteValue, &accountList.Accounts); err != nil {
-		return
+	if previous, err := readAccountsFile(file); err == nil {
+		previous.logChanges(accountList)
 	}
 
 	err = writeAccountsFile(file, accountList)
@@ -55,13 +231,7 @@ func refreshAccounts(file string) (accountList AccountList, err error) {
 }
 
 func readAccountsFile(file string) (accountList AccountList, err error) {
-	jsonFile, err := os.Open(file)
-	if err != nil {
-		return
-	}
-	defer jsonFile.Close()
-
-	byteValue, err := io.ReadAll(jsonFile)
+	byteValue, err := cacheStore.Read(file)
 	if err != nil {
 		return
 	}
@@ -76,7 +246,7 @@ func writeAccountsFile(file string, accountList AccountList) error {
 		return err
 	}
 
-	err = os.WriteFile(file, jsonData, 0644)
+	err = cacheStore.Write(file, jsonData)
 	if err != nil {
 		return err
 	}
@@ -96,43 +266,126 @@ type Account struct {
 }
 
 type AccountList struct {
-	Accounts []Account
-}
-
-func (a AccountList) Print(format string) {
-	switch format {
-	case "json":
-		jsonData, _ := json.MarshalIndent(a, "", "  ")
-		fmt.Printf("%s\n", jsonData)
-	case "text":
-		var rows []table.Row
-		for _, account := range a.Accounts {
-			if account.Status != "ACTIVE" {
-				continue
-			}
-			if env, ok := account.Tags["Environment"]; ok {
-				if _, ok := EnvironmentMap[env]; ok {
-					rows = append(rows, table.Row{
-						account.Tags["Domain"],
-						env,
-						account.Id,
-						fmt.Sprintf("AWS_PROFILE=%s-%s", env, account.Tags["Domain"]),
-						fmt.Sprintf("https://gnome.house/accounts?number=%s&role=%s", account.Id, EnvironmentMap[env].DefaultRole),
-					})
-				}
+	Accounts         []Account
+	FetchedAt        time.Time `json:"FetchedAt,omitempty"`
+	SubstrateVersion string    `json:"SubstrateVersion,omitempty"`
+}
+
+// stale is true once the list is older than the accounts TTL, lists cached before FetchedAt
+// was recorded are always stale.  A TTL of 0 never expires.
+func (a AccountList) stale() bool {
+	return accountsTTL > 0 && time.Since(a.FetchedAt) > accountsTTL
+}
+
+// logChanges logs the accounts added, removed or retagged in next, and suggests re-running
+// configure when next has environment/domain combinations a has not
+func (a AccountList) logChanges(next AccountList) {
+	before := map[string]Account{}
+	for _, account := range a.Accounts {
+		before[account.Id] = account
+	}
+	var changes []string
+	for _, account := range next.Accounts {
+		previous, ok := before[account.Id]
+		delete(before, account.Id)
+		switch {
+		case !ok:
+			changes = append(changes, fmt.Sprintf("+ %s %s", account.Id, account.describe()))
+		case previous.describe() != account.describe():
+			changes = append(changes, fmt.Sprintf("~ %s %s -> %s", account.Id, previous.describe(), account.describe()))
+		}
+	}
+	for _, account := range a.Accounts {
+		if _, ok := before[account.Id]; ok {
+			changes = append(changes, fmt.Sprintf("- %s %s", account.Id, account.describe()))
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	log.Printf("accounts changed since %s:\n%s", a.FetchedAt.Local().Format(time.DateTime), strings.Join(changes, "\n"))
+
+	oldMatrix, newMatrix := a.Matrix(), next.Matrix()
+	var added []string
+	for _, env := range newMatrix.Environments() {
+		for _, domain := range newMatrix.Domains(env) {
+			if _, ok := oldMatrix[env][domain]; !ok {
+				added = append(added, fmt.Sprintf("%s-%s", env, domain))
 			}
 		}
-		t := table.NewWriter()
-		t.SetOutputMirror(os.Stdout)
-		t.AppendHeader(table.Row{"Domain", "Envionment", "Account Number", "AWS_PROFILE", "Console"})
-		t.AppendRows(rows)
-		t.SortBy([]table.SortBy{
-			{Name: "Domain", Mode: table.Asc},
-			{Name: "Environment", Mode: table.Asc},
-		})
-		t.Render()
+	}
+	if len(added) > 0 {
+		log.Printf("new domains %s, run \"%s configure --discover\" to add their profiles", strings.Join(added, ", "), binaryName)
+	}
+}
 
-	default:
-		fmt.Println("unknown format")
+// describe summarizes the fields a change is reported for, eg. prod/api/gamma ACTIVE
+func (a Account) describe() string {
+	return fmt.Sprintf("%s (%s/%s/%s %s)", a.Name, a.Tags["Environment"], a.Tags["Domain"], a.Tags["Quality"], a.Status)
+}
+
+// Find returns the ACTIVE account tagged with environment, domain and quality
+func (a AccountList) Find(environment, domain, quality string) (Account, bool) {
+	for _, account := range a.Accounts {
+		if account.Status != "ACTIVE" {
+			continue
+		}
+		if account.Tags["Environment"] == environment && account.Tags["Domain"] == domain && account.Tags["Quality"] == quality {
+			return account, true
+		}
+	}
+	return Account{}, false
+}
+
+// Profile is the AWS_PROFILE configure writes for the account, empty for accounts it skips
+func (a Account) Profile() string {
+	if _, ok := EnvironmentMap[a.Tags["Environment"]]; ok {
+		return fmt.Sprintf("%s-%s", a.Tags["Environment"], a.Tags["Domain"])
+	}
+	if a.Name == "management" || slices.Contains(specialDomains, a.Name) {
+		return a.Name
+	}
+	return ""
+}
+
+// ConsoleURL is the console link for the environment's default role, empty for unmanaged accounts
+func (a Account) ConsoleURL() string {
+	env, ok := EnvironmentMap[a.Tags["Environment"]]
+	if !ok {
+		return ""
+	}
+	return consoleURL(a, env.DefaultRole)
+}
+
+func (a AccountList) Records() any {
+	return a.Accounts
+}
+
+func (a AccountList) Table() table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Domain", "Environment", "Account Number", "Status", "AWS_PROFILE", "Console"})
+	for _, account := range a.Accounts {
+		domain := account.Tags["Domain"]
+		if _, ok := EnvironmentMap[account.Tags["Environment"]]; !ok {
+			// unmanaged accounts (--include-unmanaged) have no domain, show their name instead
+			domain = account.Name
+		}
+		profile := "-"
+		if account.Profile() != "" {
+			profile = "AWS_PROFILE=" + account.Profile()
+		}
+		t.AppendRow(table.Row{
+			domain,
+			account.Tags["Environment"],
+			account.Id,
+			account.Status,
+			profile,
+			account.ConsoleURL(),
+		})
 	}
+	t.SortBy([]table.SortBy{
+		{Name: "Domain", Mode: table.Asc},
+		{Name: "Environment", Mode: table.Asc},
+	})
+	return t
 }
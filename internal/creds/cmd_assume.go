@@ -1,54 +1,93 @@
 package creds
 
 import (
+	"errors"
+	"fmt"
 	"log"
-	"os"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
 
 func AssumeCmd(cmd *cobra.Command, args []string) {
 	format := cmd.Flag("format").Value.String()
+	if err := validateCredentialFormat(format); err != nil {
+		log.Fatal(err)
+	}
+	shell, err := formatShell(format, cmd.Flag("shell").Value.String())
+	if err != nil {
+		log.Fatal(err)
+	}
 	force := cmd.Flag("force").Value.String()
-
-	roleData, ok := NewRoleData(cmd.Flag("env").Value.String(), cmd.Flag("domain").Value.String(), cmd.Flag("quality").Value.String(), cmd.Flag("role").Value.String())
-	if !ok {
-		cmd.Usage()
-		os.Exit(1)
+	if native, _ := strconv.ParseBool(cmd.Flag("native").Value.String()); native {
+		nativeAssume = true
 	}
 
-	defaultCreds, err := getDefaultCredentials()
+	roleData, err := roleDataFromFlags(cmd, args)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := authorizeFromFlags(cmd, roleData); err != nil {
+		exitOnError(err)
+	}
 
-	defaultCreds.SetEnv()
+	creds, err := getRoleCredentials(roleData, force == "true")
+	if err != nil {
+		exitOnError(err)
+	}
 
-	var creds Credentials
-	if force == "true" {
-		creds, err = getAndWriteCredentials(roleData, roleData.GetFilename())
-	} else {
-		creds, err = refreshCredentials(roleData, roleData.GetFilename())
+	creds.Print(format, PrintOptions{
+		Region:  cmd.Flag("region").Value.String(),
+		Profile: roleData.Profile(),
+		Shell:   shell,
+	})
+}
+
+// getRoleCredentials returns the cached credentials for role, using the default credentials
+// to fetch new ones when they are missing or expiring (or always when force is set).  Roles
+// without an account in the account list fail before substrate is asked to assume them, and
+// privileged roles fail (cache hits included) once their approval has lapsed.
+func getRoleCredentials(role RoleData, force bool) (Credentials, error) {
+	if err := requireApproval(role); err != nil {
+		return Credentials{}, err
 	}
+
+	defaultCreds, err := getDefaultCredentials()
 	if err != nil {
-		log.Fatal(err)
+		return Credentials{}, err
 	}
+	defaultCreds.SetEnv()
 
-	creds.Print(format)
+	if force {
+		return getAndWriteCredentials(role, role.GetFilename())
+	}
+	return refreshCredentials(role, role.GetFilename())
 }
 
-func NewRoleData(environment, domain, quality, role string) (RoleData, bool) {
-	if _, ok := EnvironmentMap[environment]; !ok {
-		return RoleData{}, false
+// NewRoleData resolves environment aliases (prd -> prod) and fills in the environment's default quality and role
+func NewRoleData(environment, domain, quality, role string) (RoleData, error) {
+	if environment == "" || domain == "" {
+		return RoleData{}, errors.New("an environment and domain are required, eg. --env prod --domain api or a profile like prod-api")
+	}
+	env, ok := resolveEnvironment(environment)
+	if !ok {
+		return RoleData{}, fmt.Errorf("unknown environment %q%s", environment, suggest(environment, environmentNames()))
 	}
+	environment = env
 	if quality == "" {
 		quality = EnvironmentMap[environment].DefaultQuality
 	}
+	if role == "" {
+		role = EnvironmentMap[environment].DefaultRole
+	}
+	if role == "" {
+		return RoleData{}, fmt.Errorf("environment %s has no default_role, pass one with --role", environment)
+	}
 
 	return RoleData{
 		Environment: environment,
 		Domain:      domain,
 		Quality:     quality,
 		Role:        role,
-	}, true
+	}, nil
 }
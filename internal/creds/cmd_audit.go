@@ -0,0 +1,264 @@
+package creds
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/mitchellh/go-ps"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// auditFile is an append-only JSONL log of credential requests, kept (with its rotation) by clean
+	auditFile = filepath.Join(CredsDir, "audit.jsonl")
+
+	// auditMaxSize is the size past which auditFile is rotated to auditFile.1, replacing the previous one
+	auditMaxSize = int64(getenvInt("QUIKSTRATE_AUDIT_MAX_SIZE", 10<<20))
+)
+
+type auditRecord struct {
+	Time          time.Time `json:"Time"`
+	Cache         string    `json:"Cache"` // hit or miss
+	Environment   string    `json:"Environment,omitempty"`
+	Domain        string    `json:"Domain,omitempty"`
+	Quality       string    `json:"Quality,omitempty"`
+	Role          string    `json:"Role,omitempty"`
+	Expiration    time.Time `json:"Expiration"`
+	Reason        string    `json:"Reason,omitempty"` // break-glass reason for privileged roles
+	Command       string    `json:"Command"`
+	PID           int       `json:"PID"`
+	Parent        string    `json:"Parent,omitempty"`
+	ParentCommand string    `json:"ParentCommand,omitempty"`
+	ParentPID     int       `json:"ParentPID"`
+}
+
+func auditRotation() string {
+	return auditFile + ".1"
+}
+
+// audit appends a record for every cache miss and for cache hits of privileged roles, a hit for
+// anything else would only record that credential_process ran.  Failures are logged rather than
+// failing the credential request.
+func audit(role RoleData, cacheHit bool, creds Credentials) {
+	privileged := (role != RoleData{}) && isPrivileged(role)
+	if cacheHit && !privileged {
+		return
+	}
+	record := auditRecord{
+		Time:        time.Now().UTC(),
+		Cache:       "miss",
+		Environment: role.Environment,
+		Domain:      role.Domain,
+		Quality:     role.Quality,
+		Role:        role.Role,
+		Expiration:  creds.Expiration.UTC(),
+		Command:     strings.Join(os.Args, " "),
+		PID:         os.Getpid(),
+		ParentPID:   os.Getppid(),
+	}
+	if cacheHit {
+		record.Cache = "hit"
+	}
+	if privileged {
+		record.Reason = readApprovals()[approvalKey(role)].Reason
+	}
+	if process, err := ps.FindProcess(record.ParentPID); err == nil && process != nil {
+		record.Parent = process.Executable()
+	}
+	record.ParentCommand = processCommand(record.ParentPID)
+
+	if err := rotateAuditLog(); err != nil {
+		log.Printf("unable to rotate audit log: %s", err)
+	}
+	line, _ := json.Marshal(record)
+	f, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Printf("unable to write audit log: %s", err)
+		return
+	}
+	defer f.Close()
+	// a single O_APPEND write keeps concurrent records from interleaving
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("unable to write audit log: %s", err)
+	}
+}
+
+// processCommand is the full command line of pid, empty if it has exited
+func processCommand(pid int) string {
+	if cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		// NUL separated (and terminated) arguments
+		return strings.TrimSpace(strings.ReplaceAll(string(cmdline), "\x00", " "))
+	}
+	// no procfs, eg. macOS
+	out, err := exec.Command("ps", "-o", "args=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// rotateAuditLog moves auditFile to auditRotation once it reaches auditMaxSize
+func rotateAuditLog() error {
+	if info, err := os.Stat(auditFile); err != nil || info.Size() < auditMaxSize {
+		return nil
+	}
+	unlock, err := lockFile(auditFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// another process may have rotated it while we waited for the lock
+	if info, err := os.Stat(auditFile); err != nil || info.Size() < auditMaxSize {
+		return nil
+	}
+	return os.Rename(auditFile, auditRotation())
+}
+
+type auditFilter struct {
+	Since       time.Time
+	Until       time.Time
+	Environment string
+	Domain      string
+	Role        string
+	Cache       string
+}
+
+func (f auditFilter) match(r auditRecord) bool {
+	switch {
+	case !f.Since.IsZero() && r.Time.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && r.Time.After(f.Until):
+		return false
+	case f.Environment != "" && r.Environment != f.Environment:
+		return false
+	case f.Domain != "" && r.Domain != f.Domain:
+		return false
+	case f.Role != "" && !strings.EqualFold(r.Role, f.Role):
+		return false
+	case f.Cache != "" && r.Cache != f.Cache:
+		return false
+	}
+	return true
+}
+
+func AuditCmd(cmd *cobra.Command, args []string) {
+	output, err := OutputFromFlags(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	since, err := parseAuditTime(cmd.Flag("since").Value.String())
+	if err != nil {
+		log.Fatalf("invalid --since: %s", err)
+	}
+	until, err := parseAuditTime(cmd.Flag("until").Value.String())
+	if err != nil {
+		log.Fatalf("invalid --until: %s", err)
+	}
+	filter := auditFilter{
+		Since:       since,
+		Until:       until,
+		Environment: cmd.Flag("env").Value.String(),
+		Domain:      cmd.Flag("domain").Value.String(),
+		Role:        cmd.Flag("role").Value.String(),
+		Cache:       cmd.Flag("cache").Value.String(),
+	}
+	if filter.Environment != "" {
+		if env, ok := resolveEnvironment(filter.Environment); ok {
+			filter.Environment = env
+		}
+	}
+
+	records, err := readAuditLog(filter)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if records == nil {
+		records = []auditRecord{}
+	}
+	printOutput(output, auditRecords(records))
+}
+
+// parseAuditTime accepts a duration ago (24h) or an RFC3339 time (2024-01-02T15:04:05Z)
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// readAuditLog reads the rotated log then the current one, oldest records first
+func readAuditLog(filter auditFilter) ([]auditRecord, error) {
+	var records []auditRecord
+	for _, file := range []string{auditRotation(), auditFile} {
+		var err error
+		if records, err = readAuditFile(file, filter, records); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func readAuditFile(file string, filter auditFilter, records []auditRecord) ([]auditRecord, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var record auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Printf("skipping unreadable %s line %d: %s", file, line, err)
+			continue
+		}
+		if filter.match(record) {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
+
+type auditRecords []auditRecord
+
+func (a auditRecords) Records() any {
+	return a
+}
+
+func (a auditRecords) Table() table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Time", "Cache", "Environment", "Domain", "Quality", "Role", "Expiration", "Parent", "Reason"})
+	for _, r := range a {
+		role := r.Role
+		if r.Environment == "" && r.Role == "" {
+			role = "(default)"
+		}
+		t.AppendRow(table.Row{
+			r.Time.Local().Format(time.DateTime),
+			r.Cache,
+			r.Environment,
+			r.Domain,
+			r.Quality,
+			role,
+			r.Expiration.Local().Format(time.DateTime),
+			r.Parent,
+			r.Reason,
+		})
+	}
+	return t
+}
@@ -0,0 +1,107 @@
+package creds
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditRecordsMissesAndPrivilegedHits(t *testing.T) {
+	useTestCredsDir(t)
+	useTestPolicy(t)
+	staging := RoleData{"staging", "api", "alpha", "Administrator"}
+	admin := RoleData{"prod", "api", "gamma", "Administrator"}
+	if err := recordApproval(admin, "incident"); err != nil {
+		t.Fatal(err)
+	}
+
+	creds := testCredentials("AKIA")
+	audit(RoleData{}, true, creds)
+	audit(staging, true, creds)
+	audit(staging, false, creds)
+	audit(admin, true, creds)
+
+	records, err := readAuditLog(auditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("audit logged %d records, want the miss and the privileged hit: %+v", len(records), records)
+	}
+	if records[0].Cache != "miss" || records[0].Environment != "staging" || records[0].Reason != "" {
+		t.Errorf("miss recorded as %+v", records[0])
+	}
+	if records[1].Cache != "hit" || records[1].Environment != "prod" || records[1].Reason != "incident" {
+		t.Errorf("privileged hit recorded as %+v", records[1])
+	}
+	if records[0].ParentCommand == "" {
+		t.Error("the parent's command line wasn't recorded")
+	}
+}
+
+func TestAuditRotation(t *testing.T) {
+	useTestCredsDir(t)
+	saved := auditMaxSize
+	t.Cleanup(func() { auditMaxSize = saved })
+	auditMaxSize = 1
+
+	for _, env := range []string{"dev", "staging", "prod"} {
+		audit(RoleData{env, "api", "alpha", "Auditor"}, false, testCredentials("AKIA"))
+	}
+
+	// each write rotates the previous one, only the last two are kept
+	if _, err := os.Stat(auditRotation()); err != nil {
+		t.Fatalf("%s wasn't rotated: %s", auditFile, err)
+	}
+	records, err := readAuditLog(auditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var envs []string
+	for _, record := range records {
+		envs = append(envs, record.Environment)
+	}
+	if got := strings.Join(envs, ","); got != "staging,prod" {
+		t.Errorf("readAuditLog() environments = %s, want staging,prod", got)
+	}
+
+	// clean keeps both logs
+	if err := os.WriteFile(filepath.Join(CredsDir, "cached.json"), []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanCredsDir(); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{auditFile, auditRotation()} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("clean removed %s", file)
+		}
+	}
+}
+
+func TestProcessCommand(t *testing.T) {
+	got := processCommand(os.Getpid())
+	if !strings.Contains(got, filepath.Base(os.Args[0])) || !strings.Contains(got, " -test.") {
+		t.Errorf("processCommand(self) = %q, want the test binary and its flags", got)
+	}
+	if got := processCommand(-1); got != "" {
+		t.Errorf("processCommand(-1) = %q, want empty", got)
+	}
+}
+
+func TestParseAuditTime(t *testing.T) {
+	if got, err := parseAuditTime(""); err != nil || !got.IsZero() {
+		t.Errorf("parseAuditTime(\"\") = %s, %v", got, err)
+	}
+	if got, err := parseAuditTime("24h"); err != nil || time.Since(got) < 24*time.Hour || time.Since(got) > 25*time.Hour {
+		t.Errorf("parseAuditTime(24h) = %s, %v", got, err)
+	}
+	if got, err := parseAuditTime("2024-01-02T15:04:05Z"); err != nil || !got.Equal(time.Date(2024, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("parseAuditTime(RFC3339) = %s, %v", got, err)
+	}
+	if _, err := parseAuditTime("yesterday"); err == nil {
+		t.Error("parseAuditTime(yesterday) succeeded")
+	}
+}
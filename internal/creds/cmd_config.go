@@ -0,0 +1,29 @@
+package creds
+
+import (
+	"log"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+func ConfigShowCmd(cmd *cobra.Command, args []string) {
+	output, err := OutputFromFlags(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, file := range ConfigFiles {
+		log.Printf("loaded %s", file)
+	}
+	printOutput(output, Settings)
+}
+
+func (c Config) Records() any {
+	return c
+}
+
+// Table is nil, the config is nested rather than tabular
+func (c Config) Table() table.Writer {
+	return nil
+}
@@ -1,6 +1,7 @@
 package creds
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -38,10 +39,23 @@ func ConfigureCmd(cmd *cobra.Command, args []string) {
 	configClean, _ = strconv.ParseBool(cmd.Flag("clean").Value.String())
 	configDryrun, _ = strconv.ParseBool(cmd.Flag("dryrun").Value.String())
 	configCheck, _ := strconv.ParseBool(cmd.Flag("check").Value.String())
+	discover, _ := strconv.ParseBool(cmd.Flag("discover").Value.String())
+	discoverClustersFlag, _ := strconv.ParseBool(cmd.Flag("discover-clusters").Value.String())
+	clusterAllow, _ := cmd.Flags().GetStringArray("cluster-allow")
+	clusterDeny, _ := cmd.Flags().GetStringArray("cluster-deny")
 	awsRegion = cmd.Flag("aws-region").Value.String()
 	environments := strings.Split(cmd.Flag("environments").Value.String(), ",")
 	domains := strings.Split(cmd.Flag("domains").Value.String(), ",")
 
+	matrix := flagMatrix(environments, domains)
+	if discover {
+		accountList, err := getAccountList()
+		if err != nil {
+			exitOnError(fmt.Errorf("Unable to retrieve account information: %w", err))
+		}
+		matrix = discoverMatrix(accountList, environments, domains, cmd.Flag("environments").Changed, cmd.Flag("domains").Changed)
+	}
+
 	var err error
 	binaryPath, err = exec.LookPath(binaryName)
 	if err != nil {
@@ -52,8 +66,14 @@ func ConfigureCmd(cmd *cobra.Command, args []string) {
 		binaryPath = binaryName
 	}
 
+	clusters := staticClusters(matrix)
+	if discoverClustersFlag {
+		clusters = discoverClusters(context.TODO(), matrix, awsRegion)
+	}
+	clusters = filterClusters(clusters, clusterAllow, clusterDeny)
+
 	if configCheck {
-		err := checkConfig(environments, domains)
+		err := checkConfig(clusters)
 		if err != nil {
 			log.Fatal("quikstrate configure not run...\n", err)
 		}
@@ -61,18 +81,53 @@ func ConfigureCmd(cmd *cobra.Command, args []string) {
 		os.Exit(0)
 	}
 
-	err = configureAWSConfig(environments, domains)
+	err = configureAWSConfig(matrix)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	err = configureKubeConfig(environments, domains)
+	err = configureKubeConfig(clusters)
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
-func configureAWSConfig(environments, domains []string) error {
+// flagMatrix is the --environments x --domains matrix, each at its environment's default quality
+func flagMatrix(environments, domains []string) AccountMatrix {
+	matrix := AccountMatrix{}
+	for _, environment := range environments {
+		matrix[environment] = map[string][]string{}
+		for _, domain := range domains {
+			matrix[environment][domain] = []string{EnvironmentMap[environment].DefaultQuality}
+		}
+	}
+	return matrix
+}
+
+// discoverMatrix is the account list's matrix, limited to the environments quikstrate knows about
+// (see config.yaml) and, when they were given explicitly, the --environments and --domains flags
+func discoverMatrix(accountList AccountList, environments, domains []string, filterEnvironments, filterDomains bool) AccountMatrix {
+	matrix := accountList.Matrix()
+	for environment, envDomains := range matrix {
+		if _, ok := EnvironmentMap[environment]; !ok {
+			log.Printf("Skipping environment %s, add it to the environments in %s to configure it", environment, ConfigFile)
+			delete(matrix, environment)
+			continue
+		}
+		if filterEnvironments && !slices.Contains(environments, environment) {
+			delete(matrix, environment)
+			continue
+		}
+		for domain := range envDomains {
+			if filterDomains && !slices.Contains(domains, domain) {
+				delete(envDomains, domain)
+			}
+		}
+	}
+	return matrix
+}
+
+func configureAWSConfig(matrix AccountMatrix) error {
 	log.Print("\nConfiguring aws config")
 	if configClean {
 		log.Print("Removing existing aws config")
@@ -80,11 +135,21 @@ func configureAWSConfig(environments, domains []string) error {
 	}
 
 	// reverse order so staging is before prod
+	environments := matrix.Environments()
 	sort.Sort(sort.Reverse(sort.StringSlice(environments)))
 	for _, environment := range environments {
-		for _, domain := range domains {
+		for _, domain := range matrix.Domains(environment) {
 			profile := fmt.Sprintf("%s-%s", environment, domain)
-			setAWSProfile(profile, fmt.Sprintf("\"%s assume -e %s -d %s -f json\"", binaryPath, environment, domain), awsRegion)
+			quality, ok := matrix.Quality(environment, domain)
+			if !ok {
+				log.Printf("Skipping profile %s, it has more than one quality (%s) and none is the default", profile, strings.Join(matrix.Qualities(environment, domain), ", "))
+				continue
+			}
+			command := fmt.Sprintf("%s assume -e %s -d %s", binaryPath, environment, domain)
+			if quality != EnvironmentMap[environment].DefaultQuality {
+				command += " -q " + quality
+			}
+			setAWSProfile(profile, fmt.Sprintf("\"%s -f json\"", command), awsRegion)
 		}
 	}
 
@@ -113,46 +178,39 @@ func setAWSConfigValue(profile, key, value string) {
 	}
 }
 
-func configureKubeConfig(environments, domains []string) error {
+func configureKubeConfig(clusters []KubeCluster) error {
 	log.Print("\nConfiguring kubeconfig")
 	if configClean {
 		log.Print("Removing existing kubeconfig")
 		os.Remove(kubeConfigFile)
 	}
-	for _, environment := range environments {
-		for _, cluster := range Clusters {
-			if !slices.Contains(domains, cluster.Domain) {
-				continue
-			}
-			if slices.Contains(kubeConfigSkips, fmt.Sprintf("%s-%s", environment, cluster.Domain)) {
-				continue
-			}
-
-			// aws eks update-config
-			cmd := fmt.Sprintf("aws eks update-kubeconfig --alias %[1]s-%[3]s --user-alias %[1]s-%[3]s --name %[3]s --profile %[1]s-%[2]s", environment, cluster.Domain, cluster.Name)
-			if configDryrun {
-				log.Printf("export AWS_PROFILE=%s\n", fmt.Sprintf("%s-%s", environment, cluster.Domain))
-				log.Print(cmd)
-			} else {
-				os.Setenv("AWS_PROFILE", fmt.Sprintf("%s-%s", environment, cluster.Domain))
-				_, err := script.Exec(cmd).Stdout()
-				if err != nil {
-					log.Fatal(err)
-				}
+	contexts := map[string]KubeCluster{}
+	for _, cluster := range clusters {
+		if slices.Contains(kubeConfigSkips, cluster.Profile()) {
+			continue
+		}
+		if other, ok := contexts[cluster.Context()]; ok {
+			log.Printf("Skipping %s in %s, context %s is already used by %s", cluster.Name, cluster.Profile(), cluster.Context(), other.Profile())
+			continue
+		}
+		contexts[cluster.Context()] = cluster
+
+		// aws eks update-config
+		cmd := fmt.Sprintf("aws eks update-kubeconfig --alias %[1]s --user-alias %[1]s --name %[2]s --profile %[3]s", cluster.Context(), cluster.Name, cluster.Profile())
+		if configDryrun {
+			log.Printf("export AWS_PROFILE=%s\n", cluster.Profile())
+			log.Print(cmd)
+		} else {
+			os.Setenv("AWS_PROFILE", cluster.Profile())
+			_, err := script.Exec(cmd).Stdout()
+			if err != nil {
+				log.Fatal(err)
 			}
 		}
 	}
 	return nil
 }
-func getenv(key, fallback string) string {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return fallback
-	}
-	return value
-}
-
-func checkConfig(environments, domains []string) error {
+func checkConfig(clusters []KubeCluster) error {
 	// simple ~/.aws/config check, greps for quikstrate string
 	out, err := script.IfExists(awsConfigFile).Exec("cat " + awsConfigFile).Match(binaryName).String()
 	if err != nil {
@@ -167,22 +225,17 @@ func checkConfig(environments, domains []string) error {
 	if err != nil {
 		return err
 	}
-	for _, environment := range environments {
-		for _, cluster := range Clusters {
-			if !slices.Contains(domains, cluster.Domain) {
-				continue
-			}
-			if slices.Contains(kubeConfigSkips, fmt.Sprintf("%s-%s", environment, cluster.Domain)) {
-				continue
-			}
-			clusterName := fmt.Sprintf("%s-%s", environment, cluster.Name)
+	for _, cluster := range clusters {
+		if slices.Contains(kubeConfigSkips, cluster.Profile()) {
+			continue
+		}
+		clusterName := cluster.Context()
 
-			if _, ok := config.Contexts[clusterName]; !ok {
-				return fmt.Errorf("%s doesn't contain context %s", kubeConfigFile, clusterName)
-			}
-			if _, ok := config.AuthInfos[clusterName]; !ok {
-				return fmt.Errorf("%s doesn't contain user %s", kubeConfigFile, clusterName)
-			}
+		if _, ok := config.Contexts[clusterName]; !ok {
+			return fmt.Errorf("%s doesn't contain context %s", kubeConfigFile, clusterName)
+		}
+		if _, ok := config.AuthInfos[clusterName]; !ok {
+			return fmt.Errorf("%s doesn't contain user %s", kubeConfigFile, clusterName)
 		}
 	}
 	return nil
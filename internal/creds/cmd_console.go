@@ -0,0 +1,144 @@
+package creds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func ConsoleCmd(cmd *cobra.Command, args []string) {
+	service := cmd.Flag("service").Value.String()
+	region := cmd.Flag("region").Value.String()
+	if region == "" {
+		region = DefaultRegion
+	}
+	open, _ := strconv.ParseBool(cmd.Flag("open").Value.String())
+
+	roleData, err := roleDataFromFlags(cmd, args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := authorizeFromFlags(cmd, roleData); err != nil {
+		exitOnError(err)
+	}
+
+	creds, err := getRoleCredentials(roleData, false)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	loginURL, err := federatedLoginURL(ctx, creds, consoleDestination(service, region))
+	if err != nil {
+		log.Fatalf("Unable to get a console sign-in token: %s", err)
+	}
+
+	if !open {
+		fmt.Println(loginURL)
+		return
+	}
+	if err := openURL(loginURL); err != nil {
+		log.Printf("unable to open a browser (%s), open:\n%s", err, loginURL)
+	}
+}
+
+// consoleDestination is the console page to land on, service is either a console service (s3) or a
+// path within the console (cloudwatch/home#logsV2:log-groups)
+func consoleDestination(service, region string) string {
+	destination := Settings.Console.DestinationURL
+	if service != "" {
+		if !strings.Contains(service, "/") {
+			service += "/home"
+		}
+		destination = strings.TrimSuffix(destination, "/") + "/" + strings.TrimPrefix(service, "/")
+	}
+	if region == "" {
+		return destination
+	}
+	// the region query has to come before any #fragment
+	base, fragment, hasFragment := strings.Cut(destination, "#")
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	destination = base + separator + "region=" + url.QueryEscape(region)
+	if hasFragment {
+		destination += "#" + fragment
+	}
+	return destination
+}
+
+// federatedLoginURL exchanges the role credentials for a sign-in token, see
+// https://docs.aws.amazon.com/IAM/latest/UserGuide/id_roles_providers_enable-console-custom-url.html
+func federatedLoginURL(ctx context.Context, creds Credentials, destination string) (string, error) {
+	if err := validateEndpoint(Settings.Console.FederationURL); err != nil {
+		return "", err
+	}
+	session, _ := json.Marshal(map[string]string{
+		"sessionId":    creds.AccessKeyId,
+		"sessionKey":   creds.SecretAccessKey,
+		"sessionToken": creds.SessionToken,
+	})
+	query := url.Values{
+		"Action":  {"getSigninToken"},
+		"Session": {string(session)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, Settings.Console.FederationURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// the request URL carries the credentials, so keep it out of the error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return "", fmt.Errorf("%s: %w", Settings.Console.FederationURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", Settings.Console.FederationURL, resp.Status)
+	}
+
+	var token struct {
+		SigninToken string `json:"SigninToken"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("unable to parse the sign-in token: %w", err)
+	}
+	if token.SigninToken == "" {
+		return "", fmt.Errorf("%s returned an empty sign-in token", Settings.Console.FederationURL)
+	}
+
+	login := url.Values{
+		"Action":      {"login"},
+		"Issuer":      {binaryName},
+		"Destination": {destination},
+		"SigninToken": {token.SigninToken},
+	}
+	return Settings.Console.FederationURL + "?" + login.Encode(), nil
+}
+
+func openURL(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Run()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Run()
+	default:
+		return exec.Command("xdg-open", url).Run()
+	}
+}
@@ -0,0 +1,159 @@
+package creds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func useConsoleConfig(t *testing.T, console ConsoleConfig) {
+	t.Helper()
+	saved := Settings.Console
+	t.Cleanup(func() { Settings.Console = saved })
+	Settings.Console = console
+}
+
+func TestConsoleDestination(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		service     string
+		region      string
+		want        string
+	}{
+		{name: "home", destination: "https://console.aws.amazon.com/", want: "https://console.aws.amazon.com/"},
+		{name: "region", destination: "https://console.aws.amazon.com/", region: "us-west-2", want: "https://console.aws.amazon.com/?region=us-west-2"},
+		{name: "service", destination: "https://console.aws.amazon.com/", service: "s3", region: "us-west-2", want: "https://console.aws.amazon.com/s3/home?region=us-west-2"},
+		{name: "service path", destination: "https://console.aws.amazon.com", service: "/ec2/v2/home", want: "https://console.aws.amazon.com/ec2/v2/home"},
+		{
+			name:        "fragment",
+			destination: "https://console.aws.amazon.com/",
+			service:     "cloudwatch/home#logsV2:log-groups",
+			region:      "us-east-1",
+			want:        "https://console.aws.amazon.com/cloudwatch/home?region=us-east-1#logsV2:log-groups",
+		},
+		{name: "existing query", destination: "https://console.aws.amazon.com/?hl=en", region: "us-east-1", want: "https://console.aws.amazon.com/?hl=en&region=us-east-1"},
+		{name: "govcloud", destination: "https://console.amazonaws-us-gov.com/", service: "iam", region: "us-gov-west-1", want: "https://console.amazonaws-us-gov.com/iam/home?region=us-gov-west-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConsoleConfig(t, ConsoleConfig{DestinationURL: tt.destination})
+			if got := consoleDestination(tt.service, tt.region); got != tt.want {
+				t.Errorf("consoleDestination(%q, %q) = %s, want %s", tt.service, tt.region, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEndpoint(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		wantErr  bool
+	}{
+		{endpoint: "https://signin.aws.amazon.com/federation"},
+		{endpoint: "https://signin.amazonaws-us-gov.com/federation"},
+		{endpoint: "http://localhost:9557/federation"},
+		{endpoint: "http://127.0.0.1:9557/federation"},
+		{endpoint: "http://[::1]:9557/federation"},
+		{endpoint: "http://signin.example.com/federation", wantErr: true},
+		{endpoint: "http://localhost.example.com/federation", wantErr: true},
+		{endpoint: "ftp://localhost/federation", wantErr: true},
+		{endpoint: "signin.aws.amazon.com/federation", wantErr: true},
+		{endpoint: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := validateEndpoint(tt.endpoint); (err != nil) != tt.wantErr {
+			t.Errorf("validateEndpoint(%q) error = %v, wantErr %t", tt.endpoint, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFederatedLoginURL(t *testing.T) {
+	creds := testCredentials("AKIATEST")
+	creds.SecretAccessKey = "very-secret"
+	destination := "https://console.aws.amazon.com/s3/home?region=us-west-2"
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "signed in", status: http.StatusOK, body: `{"SigninToken":"token-123"}`},
+		{name: "rejected", status: http.StatusBadRequest, body: "bad session", wantErr: "400 Bad Request"},
+		{name: "empty token", status: http.StatusOK, body: `{"SigninToken":""}`, wantErr: "empty sign-in token"},
+		{name: "unparsable", status: http.StatusOK, body: "<html>", wantErr: "unable to parse the sign-in token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var session map[string]string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if action := r.URL.Query().Get("Action"); action != "getSigninToken" {
+					t.Errorf("Action = %s, want getSigninToken", action)
+				}
+				if err := json.Unmarshal([]byte(r.URL.Query().Get("Session")), &session); err != nil {
+					t.Errorf("unparsable Session: %s", err)
+				}
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+			useConsoleConfig(t, ConsoleConfig{FederationURL: server.URL + "/federation"})
+
+			got, err := federatedLoginURL(context.Background(), creds, destination)
+			if session["sessionId"] != "AKIATEST" || session["sessionKey"] != "very-secret" || session["sessionToken"] != "token" {
+				t.Errorf("Session = %v", session)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("federatedLoginURL() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			login, err := url.Parse(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := login.Query()
+			if !strings.HasPrefix(got, server.URL+"/federation?") || query.Get("Action") != "login" ||
+				query.Get("SigninToken") != "token-123" || query.Get("Destination") != destination || query.Get("Issuer") != binaryName {
+				t.Errorf("federatedLoginURL() = %s", got)
+			}
+			if strings.Contains(got, "very-secret") {
+				t.Errorf("federatedLoginURL() = %s carries the secret key", got)
+			}
+		})
+	}
+}
+
+func TestFederatedLoginURLKeepsCredentialsOutOfErrors(t *testing.T) {
+	creds := testCredentials("AKIATEST")
+	creds.SecretAccessKey = "very-secret"
+
+	// nothing listens on the closed server's port
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	useConsoleConfig(t, ConsoleConfig{FederationURL: server.URL + "/federation"})
+	_, err := federatedLoginURL(context.Background(), creds, "https://console.aws.amazon.com/")
+	if err == nil {
+		t.Fatal("federatedLoginURL() succeeded against a closed server")
+	}
+	if strings.Contains(err.Error(), "very-secret") || strings.Contains(err.Error(), "AKIATEST") {
+		t.Errorf("federatedLoginURL() error carries the credentials: %s", err)
+	}
+
+	// never sent over plain http to anything but localhost
+	useConsoleConfig(t, ConsoleConfig{FederationURL: "http://signin.example.com/federation"})
+	if _, err := federatedLoginURL(context.Background(), creds, "https://console.aws.amazon.com/"); err == nil || !strings.Contains(err.Error(), "must be https") {
+		t.Errorf("federatedLoginURL() over http error = %v, want \"must be https\"", err)
+	}
+}
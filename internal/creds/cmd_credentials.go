@@ -9,6 +9,13 @@ import (
 
 func CredentialsCmd(cmd *cobra.Command, args []string) {
 	format := cmd.Flag("format").Value.String()
+	if err := validateCredentialFormat(format); err != nil {
+		log.Fatal(err)
+	}
+	shell, err := formatShell(format, cmd.Flag("shell").Value.String())
+	if err != nil {
+		log.Fatal(err)
+	}
 	force := cmd.Flag("force").Value.String()
 	check := cmd.Flag("check").Value.String()
 
@@ -17,16 +24,18 @@ func CredentialsCmd(cmd *cobra.Command, args []string) {
 	}
 
 	var creds Credentials
-	var err error
 	if force == "true" {
 		creds, err = getAndWriteCredentials(RoleData{}, DefaultCredsFile)
 	} else {
 		creds, err = getDefaultCredentials()
 	}
 	if err != nil {
-		log.Fatal(err)
+		exitOnError(err)
 	}
-	creds.Print(format)
+	creds.Print(format, PrintOptions{
+		Region: cmd.Flag("region").Value.String(),
+		Shell:  shell,
+	})
 }
 
 func getDefaultCredentials() (Credentials, error) {
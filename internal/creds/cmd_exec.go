@@ -0,0 +1,108 @@
+package creds
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+)
+
+// awsEnvOverrides are dropped from the parent environment so they can't shadow the injected credentials
+var awsEnvOverrides = []string{
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_SECURITY_TOKEN",
+	"AWS_PROFILE",
+	"AWS_DEFAULT_PROFILE",
+	"AWS_REGION",
+	"AWS_DEFAULT_REGION",
+}
+
+func ExecCmd(cmd *cobra.Command, args []string) {
+	region := cmd.Flag("region").Value.String()
+	force, _ := strconv.ParseBool(cmd.Flag("force").Value.String())
+
+	if len(args) == 0 {
+		cmd.Usage()
+		os.Exit(1)
+	}
+	roleData, err := roleDataFromFlags(cmd, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := authorizeFromFlags(cmd, roleData); err != nil {
+		exitOnError(err)
+	}
+
+	creds, err := getRoleCredentials(roleData, force)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	os.Exit(runWithCredentials(args, credentialsEnv(os.Environ(), creds, roleData, region)))
+}
+
+// credentialsEnv returns environ with the role credentials, region and QUIKSTRATE_PROFILE set
+func credentialsEnv(environ []string, creds Credentials, role RoleData, region string) []string {
+	var env []string
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		if slices.Contains(awsEnvOverrides, key) || key == "QUIKSTRATE_PROFILE" {
+			continue
+		}
+		env = append(env, kv)
+	}
+	return append(env,
+		"AWS_ACCESS_KEY_ID="+creds.AccessKeyId,
+		"AWS_SECRET_ACCESS_KEY="+creds.SecretAccessKey,
+		"AWS_SESSION_TOKEN="+creds.SessionToken,
+		"AWS_REGION="+region,
+		"AWS_DEFAULT_REGION="+region,
+		"QUIKSTRATE_PROFILE="+role.Profile(),
+	)
+}
+
+// runWithCredentials runs args as a child process, forwarding signals, and returns its exit code
+func runWithCredentials(args []string, env []string) int {
+	child := exec.Command(args[0], args[1:]...)
+	child.Env = env
+	child.Stdin = os.Stdin
+	child.Stdout = os.Stdout
+	child.Stderr = os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	if err := child.Start(); err != nil {
+		log.Print(err)
+		return 127
+	}
+	go func() {
+		for sig := range signals {
+			child.Process.Signal(sig)
+		}
+	}()
+
+	err := child.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	return 0
+}
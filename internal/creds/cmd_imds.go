@@ -0,0 +1,216 @@
+package creds
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	imdsTokenHeader    = "X-aws-ec2-metadata-token"
+	imdsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+	imdsMaxTokenTTL    = 21600
+)
+
+func ImdsCmd(cmd *cobra.Command, args []string) {
+	addr := cmd.Flag("addr").Value.String()
+	region := cmd.Flag("region").Value.String()
+
+	roleData, err := roleDataFromFlags(cmd, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := authorizeFromFlags(cmd, roleData); err != nil {
+		exitOnError(err)
+	}
+
+	accountList, err := getAccountList()
+	if err != nil {
+		exitOnError(fmt.Errorf("Unable to retrieve account information: %w", err))
+	}
+	account, ok := accountList.Find(roleData.Environment, roleData.Domain, roleData.Quality)
+	if !ok {
+		log.Fatalf("No account found for %s-%s-%s", roleData.Environment, roleData.Domain, roleData.Quality)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	holder := newCredentialHolder()
+	if _, err := holder.get(roleData); err != nil {
+		exitOnError(err)
+	}
+	go holder.refreshLoop(ctx, serveRefreshInterval)
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: newImdsHandler(holder, roleData, account, region),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("serving %s credentials (%s) on http://%s, configure clients with:", roleData.Role, account.Id, addr)
+	log.Printf("  AWS_EC2_METADATA_SERVICE_ENDPOINT=http://%s", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// imdsCredentials is the response format of iam/security-credentials/<role>
+type imdsCredentials struct {
+	Code            string `json:"Code"`
+	LastUpdated     string `json:"LastUpdated"`
+	Type            string `json:"Type"`
+	AccessKeyId     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration"`
+}
+
+// imdsIdentityDocument is the response format of dynamic/instance-identity/document
+type imdsIdentityDocument struct {
+	AccountId        string `json:"accountId"`
+	Architecture     string `json:"architecture"`
+	AvailabilityZone string `json:"availabilityZone"`
+	ImageId          string `json:"imageId"`
+	InstanceId       string `json:"instanceId"`
+	InstanceType     string `json:"instanceType"`
+	PendingTime      string `json:"pendingTime"`
+	PrivateIp        string `json:"privateIp"`
+	Region           string `json:"region"`
+	Version          string `json:"version"`
+}
+
+// imdsTokens tracks the session tokens handed out by PUT /latest/api/token
+type imdsTokens struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+}
+
+// issue also evicts expired tokens, so SDKs that fetch a token per request don't grow the map forever
+func (t *imdsTokens) issue(ttl time.Duration) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	for token, expiry := range t.tokens {
+		if now.After(expiry) {
+			delete(t.tokens, token)
+		}
+	}
+	token := randomToken()
+	t.tokens[token] = time.Now().Add(ttl)
+	return token
+}
+
+func (t *imdsTokens) valid(token string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	expiry, ok := t.tokens[token]
+	if ok && time.Now().After(expiry) {
+		delete(t.tokens, token)
+		return false
+	}
+	return ok
+}
+
+func newImdsHandler(holder *credentialHolder, roleData RoleData, account Account, region string) http.Handler {
+	tokens := &imdsTokens{tokens: map[string]time.Time{}}
+	startTime := time.Now().UTC().Format(time.RFC3339)
+	instanceId := fmt.Sprintf("i-quikstrate%s", account.Id)
+	credsPath := "/latest/meta-data/iam/security-credentials/"
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest/api/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		ttl, err := strconv.Atoi(r.Header.Get(imdsTokenTTLHeader))
+		if err != nil || ttl < 1 || ttl > imdsMaxTokenTTL {
+			http.Error(w, "invalid "+imdsTokenTTLHeader, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set(imdsTokenTTLHeader, strconv.Itoa(ttl))
+		fmt.Fprint(w, tokens.issue(time.Duration(ttl)*time.Second))
+	})
+	mux.HandleFunc(credsPath, func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, credsPath) {
+		case "":
+			fmt.Fprint(w, roleData.Role)
+		case roleData.Role:
+			creds, err := holder.get(roleData)
+			if err != nil {
+				log.Printf("unable to get credentials for %+v: %s", roleData, err)
+				http.Error(w, "unable to get credentials", http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, imdsCredentials{
+				Code:            "Success",
+				LastUpdated:     time.Now().UTC().Format(time.RFC3339),
+				Type:            "AWS-HMAC",
+				AccessKeyId:     creds.AccessKeyId,
+				SecretAccessKey: creds.SecretAccessKey,
+				Token:           creds.SessionToken,
+				Expiration:      creds.Expiration.UTC().Format(time.RFC3339),
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("/latest/meta-data/iam/info", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{
+			"Code":               "Success",
+			"LastUpdated":        startTime,
+			"InstanceProfileArn": fmt.Sprintf("arn:aws:iam::%s:instance-profile/%s", account.Id, roleData.Role),
+			"InstanceProfileId":  "AIPAQUIKSTRATE",
+		})
+	})
+	mux.HandleFunc("/latest/dynamic/instance-identity/document", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, imdsIdentityDocument{
+			AccountId:        account.Id,
+			Architecture:     "x86_64",
+			AvailabilityZone: region + "a",
+			ImageId:          "ami-00000000",
+			InstanceId:       instanceId,
+			InstanceType:     "t3.micro",
+			PendingTime:      startTime,
+			PrivateIp:        "127.0.0.1",
+			Region:           region,
+			Version:          "2017-09-30",
+		})
+	})
+	mux.HandleFunc("/latest/meta-data/instance-id", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, instanceId)
+	})
+	mux.HandleFunc("/latest/meta-data/placement/region", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, region)
+	})
+	mux.HandleFunc("/latest/meta-data/placement/availability-zone", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, region+"a")
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		// IMDSv2 only, every request other than the token request needs a session token
+		if r.URL.Path != "/latest/api/token" && !tokens.valid(r.Header.Get(imdsTokenHeader)) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
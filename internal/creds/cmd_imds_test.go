@@ -0,0 +1,24 @@
+package creds
+
+import (
+	"testing"
+	"time"
+)
+
+func TestImdsTokensEvictExpired(t *testing.T) {
+	tokens := &imdsTokens{tokens: map[string]time.Time{}}
+	expired := tokens.issue(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	live := tokens.issue(time.Hour)
+
+	if _, ok := tokens.tokens[expired]; ok {
+		t.Error("issue kept an expired token")
+	}
+	if !tokens.valid(live) {
+		t.Error("new token is not valid")
+	}
+	if tokens.valid(expired) {
+		t.Error("expired token is valid")
+	}
+}
@@ -0,0 +1,278 @@
+package creds
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	serveRefreshInterval = 30 * time.Second
+	// roles unused for serveRoleIdle stop being refreshed, and at most serveMaxRoles are held at once
+	serveRoleIdle = time.Hour
+	serveMaxRoles = 32
+)
+
+var (
+	// servedNameRegex guards the /role/ path segments, which end up as substrate arguments
+	servedNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+	servedRoleRegex = regexp.MustCompile(`^[A-Za-z0-9+=,.@_][\w+=,.@-]*$`)
+)
+
+func ServeCmd(cmd *cobra.Command, args []string) {
+	addr := cmd.Flag("addr").Value.String()
+	token := cmd.Flag("token").Value.String()
+	if token == "" {
+		token = os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	}
+	if token == "" {
+		token = randomToken()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	holder := newCredentialHolder()
+	if _, err := holder.get(RoleData{}); err != nil {
+		exitOnError(err)
+	}
+	go holder.refreshLoop(ctx, serveRefreshInterval)
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: newCredentialsHandler(holder, token),
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("serving credentials on http://%s, configure clients with:", addr)
+	log.Printf("  AWS_CONTAINER_CREDENTIALS_FULL_URI=http://%s/creds  (or /role/<env>/<domain>?quality=<quality>&role=<role>)", addr)
+	log.Printf("  AWS_CONTAINER_AUTHORIZATION_TOKEN=%s", token)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
+
+// containerCredentials is the response format of the ECS container credentials provider
+// https://docs.aws.amazon.com/sdkref/latest/guide/feature-container-credentials.html
+type containerCredentials struct {
+	AccessKeyId     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration"`
+}
+
+func newCredentialsHandler(holder *credentialHolder, token string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/creds", func(w http.ResponseWriter, r *http.Request) {
+		serveCredentials(w, holder, RoleData{})
+	})
+	mux.HandleFunc("/role/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/role/"), "/"), "/")
+		if len(parts) != 2 {
+			http.Error(w, "expected /role/<env>/<domain>", http.StatusNotFound)
+			return
+		}
+		roleData, err := NewRoleData(parts[0], parts[1], r.URL.Query().Get("quality"), r.URL.Query().Get("role"))
+		if err == nil {
+			err = validateServedRole(roleData)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err := authorizeRole(roleData, false, "", false); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		serveCredentials(w, holder, roleData)
+	})
+	return requireToken(token, mux)
+}
+
+// validateServedRole allows only known environments and domains (from the config or the cached
+// account list) and IAM-safe quality and role names
+func validateServedRole(role RoleData) error {
+	if _, ok := EnvironmentMap[role.Environment]; !ok {
+		return fmt.Errorf("unknown environment %q", role.Environment)
+	}
+	known := slices.Contains(Domains, role.Domain)
+	if matrix, ok := cachedMatrix(); ok && !known {
+		_, known = matrix[role.Environment][role.Domain]
+	}
+	if !known || !servedNameRegex.MatchString(role.Domain) {
+		return fmt.Errorf("unknown domain %q", role.Domain)
+	}
+	if !servedNameRegex.MatchString(role.Quality) {
+		return fmt.Errorf("invalid quality %q", role.Quality)
+	}
+	if !servedRoleRegex.MatchString(role.Role) {
+		return fmt.Errorf("invalid role %q", role.Role)
+	}
+	return nil
+}
+
+func serveCredentials(w http.ResponseWriter, holder *credentialHolder, role RoleData) {
+	creds, err := holder.get(role)
+	if err != nil {
+		log.Printf("unable to get credentials for %+v: %s", role, err)
+		http.Error(w, "unable to get credentials", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, containerCredentials{
+		AccessKeyId:     creds.AccessKeyId,
+		SecretAccessKey: creds.SecretAccessKey,
+		Token:           creds.SessionToken,
+		Expiration:      creds.Expiration.UTC().Format(time.RFC3339),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	jsonData, _ := json.MarshalIndent(v, "", "  ")
+	w.Write(jsonData)
+}
+
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(token)) != 1 {
+			log.Printf("%s %s: unauthorized", r.Method, r.URL.Path)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		log.Printf("%s %s", r.Method, r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// credentialHolder keeps credentials in memory and refreshes them before they expire.
+// Fetches are serialized since assuming a role sets the default credentials in the process env.
+type credentialHolder struct {
+	mu       sync.Mutex
+	creds    map[RoleData]Credentials
+	lastUsed map[RoleData]time.Time
+}
+
+func newCredentialHolder() *credentialHolder {
+	return &credentialHolder{creds: map[RoleData]Credentials{}, lastUsed: map[RoleData]time.Time{}}
+}
+
+// get returns the credentials for role, fetching them when missing or expiring
+func (h *credentialHolder) get(role RoleData) (Credentials, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastUsed[role] = time.Now()
+	return h.fetch(role)
+}
+
+// fetch expects the caller to hold the lock
+func (h *credentialHolder) fetch(role RoleData) (Credentials, error) {
+	if err := requireApproval(role); err != nil {
+		// the approval lapsed, stop handing out (and refreshing) the role until it is approved again
+		delete(h.creds, role)
+		delete(h.lastUsed, role)
+		return Credentials{}, err
+	}
+	if creds, ok := h.creds[role]; ok && !creds.needsRefresh() {
+		return creds, nil
+	}
+	var creds Credentials
+	var err error
+	if (role == RoleData{}) {
+		creds, err = getDefaultCredentials()
+	} else {
+		creds, err = getRoleCredentials(role, false)
+	}
+	if err != nil {
+		return Credentials{}, err
+	}
+	h.creds[role] = creds
+	h.evict()
+	return creds, nil
+}
+
+// evict drops roles idle for serveRoleIdle, then the least recently used beyond serveMaxRoles.
+// The default credentials are always kept, everything else relies on them.
+func (h *credentialHolder) evict() {
+	var roles []RoleData
+	for role := range h.creds {
+		if (role == RoleData{}) {
+			continue
+		}
+		if time.Since(h.lastUsed[role]) > serveRoleIdle {
+			delete(h.creds, role)
+			delete(h.lastUsed, role)
+			continue
+		}
+		roles = append(roles, role)
+	}
+	if len(roles) <= serveMaxRoles {
+		return
+	}
+	sort.Slice(roles, func(i, j int) bool { return h.lastUsed[roles[i]].Before(h.lastUsed[roles[j]]) })
+	for _, role := range roles[:len(roles)-serveMaxRoles] {
+		delete(h.creds, role)
+		delete(h.lastUsed, role)
+	}
+}
+
+func (h *credentialHolder) refreshLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.mu.Lock()
+			h.evict()
+			var roles []RoleData
+			for role := range h.creds {
+				roles = append(roles, role)
+			}
+			h.mu.Unlock()
+
+			for _, role := range roles {
+				// refreshing doesn't count as a use, so idle roles still age out
+				h.mu.Lock()
+				var err error
+				if _, held := h.creds[role]; held {
+					_, err = h.fetch(role)
+				}
+				h.mu.Unlock()
+				if err != nil {
+					log.Printf("unable to refresh credentials for %+v: %s", role, err)
+				}
+			}
+		}
+	}
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,92 @@
+package creds
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useServedDomains configures only the api domain, with the cached account list adding staging-lambda
+func useServedDomains(t *testing.T) {
+	t.Helper()
+	useTestCredsDir(t)
+	useTestEnvironments(t)
+	saved := Domains
+	t.Cleanup(func() { Domains = saved })
+	Domains = []string{"api"}
+	err := writeAccountsFile(accountsFile, AccountList{Accounts: []Account{
+		{Id: "222222222223", Status: "ACTIVE", Tags: map[string]string{"Environment": "staging", "Domain": "lambda", "Quality": "beta"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateServedRole(t *testing.T) {
+	useServedDomains(t)
+	tests := []struct {
+		name    string
+		role    RoleData
+		wantErr bool
+	}{
+		{"known", RoleData{"prod", "api", "gamma", "Auditor"}, false},
+		{"known other environment", RoleData{"staging", "api", "alpha", "Administrator"}, false},
+		{"cached account", RoleData{"staging", "lambda", "beta", "Administrator"}, false},
+		{"cached in another environment", RoleData{"prod", "lambda", "gamma", "Auditor"}, true},
+		{"unconfigured domain", RoleData{"prod", "static-sites", "gamma", "Auditor"}, true},
+		{"unknown environment", RoleData{"dev", "api", "gamma", "Auditor"}, true},
+		{"unknown domain", RoleData{"prod", "billing-secrets", "gamma", "Auditor"}, true},
+		{"flag as quality", RoleData{"prod", "api", "--management", "Auditor"}, true},
+		{"flag as role", RoleData{"prod", "api", "gamma", "-x"}, true},
+		{"path in role", RoleData{"prod", "api", "gamma", "../Administrator"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateServedRole(tt.role); (err != nil) != tt.wantErr {
+				t.Errorf("validateServedRole(%+v) = %v, want error %v", tt.role, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRoleHandlerRejectsUnknownRoles(t *testing.T) {
+	useServedDomains(t)
+	handler := newCredentialsHandler(newCredentialHolder(), "token")
+	for _, path := range []string{"/role/prod/nope", "/role/dev/api", "/role/prod/lambda", "/role/prod/api?role=-x"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestCredentialHolderEvict(t *testing.T) {
+	h := newCredentialHolder()
+	h.creds[RoleData{}] = Credentials{}
+	h.creds[RoleData{"prod", "api", "gamma", "Auditor"}] = Credentials{}
+	h.lastUsed[RoleData{"prod", "api", "gamma", "Auditor"}] = time.Now().Add(-2 * serveRoleIdle)
+	for i := 0; i < serveMaxRoles+5; i++ {
+		role := RoleData{"staging", "api", "alpha", string(rune('A' + i))}
+		h.creds[role] = Credentials{}
+		h.lastUsed[role] = time.Now().Add(time.Duration(i) * time.Second)
+	}
+
+	h.evict()
+
+	if _, ok := h.creds[RoleData{}]; !ok {
+		t.Error("evict dropped the default credentials")
+	}
+	if _, ok := h.creds[RoleData{"prod", "api", "gamma", "Auditor"}]; ok {
+		t.Error("evict kept an idle role")
+	}
+	if got := len(h.creds); got != serveMaxRoles+1 {
+		t.Errorf("evict kept %d roles, want %d", got, serveMaxRoles+1)
+	}
+	if _, ok := h.creds[RoleData{"staging", "api", "alpha", "A"}]; ok {
+		t.Error("evict kept the least recently used role")
+	}
+}
@@ -0,0 +1,192 @@
+package creds
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-ps"
+	"github.com/spf13/cobra"
+)
+
+func ShellCmd(cmd *cobra.Command, args []string) {
+	region := cmd.Flag("region").Value.String()
+	force, _ := strconv.ParseBool(cmd.Flag("force").Value.String())
+	shellName, err := getShell(cmd.Flag("shell").Value.String())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	roleData, err := roleDataFromFlags(cmd, nil)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := authorizeFromFlags(cmd, roleData); err != nil {
+		exitOnError(err)
+	}
+	// the refresh hook never prompts, so it needs the confirmation as an approval
+	if err := recordConfirmation(roleData, "confirmed at the terminal for a shell"); err != nil {
+		log.Fatal(err)
+	}
+	if profile := os.Getenv("QUIKSTRATE_PROFILE"); profile != "" {
+		log.Printf("already in a quikstrate shell for %s, exit it first", profile)
+		os.Exit(1)
+	}
+
+	creds, err := getRoleCredentials(roleData, force)
+	if err != nil {
+		exitOnError(err)
+	}
+
+	cleanShellDirs()
+	dir := filepath.Join(shellDir, strconv.Itoa(os.Getpid()))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Fatal(err)
+	}
+	shell := newSubshell(shellName, dir, fmt.Sprintf("[%s]", roleData.Profile()), roleData)
+	shellArgs, env, err := shell.setup(credentialsEnv(os.Environ(), creds, roleData, region))
+	if err != nil {
+		os.RemoveAll(dir)
+		log.Fatal(err)
+	}
+
+	log.Printf("starting %s with %s credentials, exit the shell to drop them", shell.name, roleData.Profile())
+	code := runWithCredentials(shellArgs, env)
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// shellDir holds a directory of startup files per running subshell, none of them contain credentials
+var shellDir = filepath.Join(CredsDir, "shell")
+
+// shellRefreshCheck is how often (at most) the prompt hook asks quikstrate for fresh credentials
+const shellRefreshCheck = time.Minute
+
+// cleanShellDirs removes the startup files of subshells that are no longer running, eg. after a crash
+func cleanShellDirs() {
+	entries, err := os.ReadDir(shellDir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err == nil {
+			if process, err := ps.FindProcess(pid); err == nil && process != nil {
+				continue
+			}
+		}
+		os.RemoveAll(filepath.Join(shellDir, entry.Name()))
+	}
+}
+
+// subshell starts an interactive shell whose prompt shows the profile.  Before a prompt (at most once
+// every shellRefreshCheck) a hook evals "quikstrate assume -f export --no-prompt", so refreshed
+// credentials reach the shell through a pipe and are never written out in plaintext.  The hook stops
+// once assume exits with exitBreakGlassRequired, ie. a privileged role's approval lapsed.
+type subshell struct {
+	name   string
+	path   string
+	dir    string
+	prompt string
+	role   RoleData
+}
+
+func newSubshell(name, dir, prompt string, role RoleData) subshell {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		path = getenv("SHELL", "/bin/sh")
+		name, _ = normalizeShell(path)
+	}
+	return subshell{name: name, path: path, dir: dir, prompt: prompt, role: role}
+}
+
+// assumeCommand is the quikstrate command line the refresh hook evals, quoted with quote
+func (s subshell) assumeCommand(quote func(string) string) string {
+	self, err := os.Executable()
+	if err != nil {
+		self = binaryName
+	}
+	args := []string{self, "assume", "-e", s.role.Environment, "-d", s.role.Domain, "-q", s.role.Quality, "-r", s.role.Role, "-f", "export", "--shell", s.name, "--no-prompt"}
+	for i, arg := range args {
+		args[i] = quote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// setup returns the command line and environment that start the shell with our prompt and refresh hook
+func (s subshell) setup(env []string) ([]string, []string, error) {
+	env = append(env,
+		"QUIKSTRATE_PROMPT="+s.prompt,
+		fmt.Sprintf("QUIKSTRATE_REFRESH_AT=%d", time.Now().Add(shellRefreshCheck).Unix()),
+	)
+	prompt := posixQuote(s.prompt + " ")
+	check := strconv.Itoa(int(shellRefreshCheck.Seconds()))
+	stop, never := strconv.Itoa(exitBreakGlassRequired), "9999999999"
+	refresh := strings.Join([]string{
+		`_quikstrate_refresh() {`,
+		`  local now=${EPOCHSECONDS:-$(date +%s)}`,
+		`  [ "$now" -lt "${QUIKSTRATE_REFRESH_AT:-0}" ] && return`,
+		`  QUIKSTRATE_REFRESH_AT=$((now + ` + check + `))`,
+		`  local out`,
+		`  out="$(` + s.assumeCommand(posixQuote) + `)"`,
+		`  case $? in`,
+		`    0) eval "$out" ;;`,
+		`    ` + stop + `) QUIKSTRATE_REFRESH_AT=` + never + ` ;;`,
+		`  esac`,
+		`}`,
+	}, "\n")
+
+	switch s.name {
+	case "bash":
+		rc := strings.Join([]string{
+			`[ -f ~/.bashrc ] && . ~/.bashrc`,
+			`PS1=` + prompt + `"$PS1"`,
+			refresh,
+			`PROMPT_COMMAND="_quikstrate_refresh${PROMPT_COMMAND:+;$PROMPT_COMMAND}"`,
+		}, "\n")
+		rcFile := filepath.Join(s.dir, "bashrc")
+		if err := writeCacheFile(rcFile, []byte(rc+"\n")); err != nil {
+			return nil, nil, err
+		}
+		return []string{s.path, "--rcfile", rcFile, "-i"}, env, nil
+
+	case "zsh":
+		// zsh reads its startup files from ZDOTDIR, point it at ours and have them source the originals
+		origDir := getenv("ZDOTDIR", home)
+		zshenv := `[ -f "$QUIKSTRATE_ZDOTDIR/.zshenv" ] && . "$QUIKSTRATE_ZDOTDIR/.zshenv"`
+		zshrc := strings.Join([]string{
+			`ZDOTDIR="$QUIKSTRATE_ZDOTDIR"`,
+			`[ -f "$ZDOTDIR/.zshrc" ] && . "$ZDOTDIR/.zshrc"`,
+			`zmodload zsh/datetime 2>/dev/null`,
+			`PROMPT=` + prompt + `"$PROMPT"`,
+			refresh,
+			`precmd_functions+=(_quikstrate_refresh)`,
+		}, "\n")
+		if err := writeCacheFile(filepath.Join(s.dir, ".zshenv"), []byte(zshenv+"\n")); err != nil {
+			return nil, nil, err
+		}
+		if err := writeCacheFile(filepath.Join(s.dir, ".zshrc"), []byte(zshrc+"\n")); err != nil {
+			return nil, nil, err
+		}
+		env = append(env, "QUIKSTRATE_ZDOTDIR="+origDir, "ZDOTDIR="+s.dir)
+		return []string{s.path, "-i"}, env, nil
+
+	case "fish":
+		prompt = fishQuote(s.prompt + " ")
+		init := strings.Join([]string{
+			`functions -c fish_prompt _quikstrate_fish_prompt`,
+			`function fish_prompt; echo -n ` + prompt + `; _quikstrate_fish_prompt; end`,
+			`function _quikstrate_refresh --on-event fish_prompt; set -l now (date +%s); test $now -lt $QUIKSTRATE_REFRESH_AT; and return; set -gx QUIKSTRATE_REFRESH_AT (math $now + ` + check + `); set -l out (` + s.assumeCommand(fishQuote) + `); switch $status; case 0; printf '%s\n' $out | source; case ` + stop + `; set -gx QUIKSTRATE_REFRESH_AT ` + never + `; end; end`,
+		}, "; ")
+		return []string{s.path, "-i", "-C", init}, env, nil
+
+	default:
+		log.Printf("%s doesn't support prompt markers or auto-refresh, restart it when the credentials expire", s.name)
+		return []string{s.path, "-i"}, env, nil
+	}
+}
@@ -0,0 +1,127 @@
+package creds
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// assumeFlags has the flags of cmd's assume command that the refresh hook passes
+func assumeFlags() *cobra.Command {
+	cmd := &cobra.Command{}
+	for _, name := range []string{"env", "domain", "quality", "role", "format"} {
+		cmd.Flags().StringP(name, name[:1], "", "")
+	}
+	cmd.Flags().String("shell", "", "")
+	cmd.Flags().String("reason", "", "")
+	cmd.Flags().Bool("break-glass", false, "")
+	cmd.Flags().Bool("no-prompt", false, "")
+	return cmd
+}
+
+// atTerminal pretends a person is at the terminal, failing the test if they are asked anything
+func atTerminal(t *testing.T) {
+	t.Helper()
+	savedInteractive, savedConfirm := isInteractive, confirmAtTerminal
+	t.Cleanup(func() { isInteractive, confirmAtTerminal = savedInteractive, savedConfirm })
+	isInteractive = func() bool { return true }
+	confirmAtTerminal = func(role RoleData) bool {
+		t.Errorf("asked to confirm %s %s", role.Profile(), role.Role)
+		return true
+	}
+}
+
+func TestRefreshHookDoesNotPrompt(t *testing.T) {
+	useTestCredsDir(t)
+	useTestPolicy(t)
+	atTerminal(t)
+	admin := RoleData{"prod", "api", "gamma", "Administrator"}
+	shell := subshell{name: "bash", path: "/bin/bash", dir: t.TempDir(), prompt: "[prod-api]", role: admin}
+
+	cmd := assumeFlags()
+	args := strings.Fields(shell.assumeCommand(func(s string) string { return s }))
+	if args[1] != "assume" {
+		t.Fatalf("the hook runs %v", args)
+	}
+	if err := cmd.ParseFlags(args[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := authorizeFromFlags(cmd, admin); !errors.Is(err, ErrBreakGlassRequired) {
+		t.Errorf("hook without an approval: error = %v, want ErrBreakGlassRequired", err)
+	}
+	writeApproval(t, admin, time.Now().Add(time.Minute))
+	if err := authorizeFromFlags(cmd, admin); err != nil {
+		t.Errorf("hook with an approval: %s", err)
+	}
+
+	// the hook stops once assume exits for a lapsed approval
+	shellArgs, _, err := shell.setup(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, err := os.ReadFile(filepath.Join(shell.dir, "bashrc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shellArgs[1] != "--rcfile" || !strings.Contains(string(rc), "--no-prompt") || !strings.Contains(string(rc), "5) QUIKSTRATE_REFRESH_AT=9999999999") {
+		t.Errorf("bashrc:\n%s", rc)
+	}
+}
+
+func TestRecordConfirmation(t *testing.T) {
+	useTestCredsDir(t)
+	useTestPolicy(t)
+	admin := RoleData{"prod", "api", "gamma", "Administrator"}
+
+	// nothing to record without a confirmation, or with an expired one
+	if err := recordConfirmation(admin, "shell"); err != nil {
+		t.Fatal(err)
+	}
+	confirmations[approvalKey(admin)] = time.Now().Add(-time.Minute)
+	if err := recordConfirmation(admin, "shell"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := readApprovals()[approvalKey(admin)]; ok {
+		t.Fatal("recorded an approval without a confirmation")
+	}
+
+	confirmations[approvalKey(admin)] = time.Now().Add(time.Hour)
+	if err := recordConfirmation(admin, "shell"); err != nil {
+		t.Fatal(err)
+	}
+	approval, ok := readApprovals()[approvalKey(admin)]
+	if !ok || approval.Reason != "shell" || time.Until(approval.ExpiresAt) > breakGlassLifetime {
+		t.Errorf("recorded %+v (ok %t)", approval, ok)
+	}
+}
+
+func TestAuthorizeRolePrompts(t *testing.T) {
+	useTestCredsDir(t)
+	useTestPolicy(t)
+	atTerminal(t)
+	admin := RoleData{"prod", "api", "gamma", "Administrator"}
+
+	var asked int
+	confirmAtTerminal = func(role RoleData) bool {
+		asked++
+		return true
+	}
+	if err := authorizeRole(admin, false, "", true); err != nil {
+		t.Fatal(err)
+	}
+	// confirmed for the rest of the process
+	if err := authorizeRole(admin, false, "", true); err != nil || asked != 1 {
+		t.Errorf("second authorizeRole() = %v, asked %d times, want once", err, asked)
+	}
+
+	confirmAtTerminal = func(role RoleData) bool { return false }
+	delete(confirmations, approvalKey(admin))
+	if err := authorizeRole(admin, false, "", true); err == nil || errors.Is(err, ErrBreakGlassRequired) {
+		t.Errorf("declined authorizeRole() error = %v, want not confirmed", err)
+	}
+}
@@ -0,0 +1,173 @@
+package creds
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+func StatusCmd(cmd *cobra.Command, args []string) {
+	output, err := OutputFromFlags(cmd)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// status is diagnostic, it must not create the encryption key or migrate plaintext files
+	cacheStore = readOnlyCacheStore(cacheStore)
+
+	statuses, err := getCacheStatuses()
+	if err != nil {
+		log.Fatal(err)
+	}
+	printOutput(output, statuses)
+}
+
+type cacheStatus struct {
+	Type         string        `json:"Type"`
+	File         string        `json:"File"`
+	Environment  string        `json:"Environment,omitempty"`
+	Domain       string        `json:"Domain,omitempty"`
+	Quality      string        `json:"Quality,omitempty"`
+	Role         string        `json:"Role,omitempty"`
+	Expiration   *time.Time    `json:"Expiration,omitempty"`
+	Remaining    time.Duration `json:"-"`
+	NeedsRefresh bool          `json:"NeedsRefresh"`
+	Accounts     int           `json:"Accounts,omitempty"`
+	Age          time.Duration `json:"-"`
+	Error        string        `json:"Error,omitempty"`
+
+	RemainingSeconds int64 `json:"RemainingSeconds,omitempty"`
+	AgeSeconds       int64 `json:"AgeSeconds"`
+}
+
+type cacheStatuses []cacheStatus
+
+func getCacheStatuses() (cacheStatuses, error) {
+	entries, err := os.ReadDir(CredsDir)
+	if os.IsNotExist(err) {
+		return cacheStatuses{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses cacheStatuses
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		file := filepath.Join(CredsDir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		status := cacheStatus{
+			File: file,
+			Age:  time.Since(info.ModTime()).Round(time.Second),
+		}
+		status.AgeSeconds = int64(status.Age.Seconds())
+
+		switch file {
+		case accountsFile:
+			status.Type = "accounts"
+			accountList, err := readAccountsFile(file)
+			if err != nil {
+				status.Error = err.Error()
+			}
+			status.Accounts = len(accountList.Accounts)
+		case DefaultCredsFile:
+			status.Type = "default"
+			status.setCredentials(file)
+		default:
+			role, ok := parseRoleFilename(entry.Name())
+			if !ok {
+				continue
+			}
+			status.Type = "role"
+			status.Environment = role.Environment
+			status.Domain = role.Domain
+			status.Quality = role.Quality
+			status.Role = role.Role
+			status.setCredentials(file)
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].sortKey() < statuses[j].sortKey()
+	})
+	return statuses, nil
+}
+
+func (s *cacheStatus) setCredentials(file string) {
+	creds, err := getCredsFromFile(file)
+	if err != nil {
+		s.Error = err.Error()
+		s.NeedsRefresh = true
+		return
+	}
+	s.Expiration = &creds.Expiration
+	s.Remaining = time.Until(creds.Expiration).Round(time.Second)
+	s.RemainingSeconds = int64(s.Remaining.Seconds())
+	s.NeedsRefresh = creds.needsRefresh()
+}
+
+func (s cacheStatus) sortKey() string {
+	order := map[string]string{"default": "0", "role": "1", "accounts": "2"}
+	return order[s.Type] + filepath.Base(s.File)
+}
+
+// parseRoleFilename reverses RoleData.GetFilename.  Domains may contain dashes (eg. static-sites)
+// so the environment is the first segment and the quality and role are the last two.
+func parseRoleFilename(name string) (RoleData, bool) {
+	parts := strings.Split(strings.TrimSuffix(name, ".json"), "-")
+	if len(parts) < 4 {
+		return RoleData{}, false
+	}
+	return RoleData{
+		Environment: parts[0],
+		Domain:      strings.Join(parts[1:len(parts)-2], "-"),
+		Quality:     parts[len(parts)-2],
+		Role:        parts[len(parts)-1],
+	}, true
+}
+
+func (s cacheStatuses) Records() any {
+	return s
+}
+
+func (s cacheStatuses) Table() table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Type", "Environment", "Domain", "Quality", "Role", "Expires In", "Needs Refresh", "File Age", "Error"})
+	for _, status := range s {
+		expiresIn := "-"
+		if status.Expiration != nil {
+			expiresIn = status.Remaining.String()
+		}
+		needsRefresh := fmt.Sprint(status.NeedsRefresh)
+		statusType := status.Type
+		if status.Type == "accounts" {
+			statusType = fmt.Sprintf("accounts (%d)", status.Accounts)
+			needsRefresh = "-"
+		}
+		t.AppendRow(table.Row{
+			statusType,
+			status.Environment,
+			status.Domain,
+			status.Quality,
+			status.Role,
+			expiresIn,
+			needsRefresh,
+			status.Age.String(),
+			status.Error,
+		})
+	}
+	return t
+}
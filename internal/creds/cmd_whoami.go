@@ -2,79 +2,100 @@ package creds
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/jedib0t/go-pretty/v6/table"
 	"github.com/spf13/cobra"
 )
 
-var assumedRoleRegex = regexp.MustCompile("arn:aws:sts::([a-z0-9]+):assumed-role/(.+?)/(.+)")
+// ssoRoleRegex matches the roles IAM Identity Center creates for a permission set
+var ssoRoleRegex = regexp.MustCompile(`^AWSReservedSSO_(.+)_[0-9a-f]{16}$`)
 
 func WhoamiCmd(cmd *cobra.Command, args []string) {
-	format := cmd.Flag("format").Value.String()
-
-	accountList, err := getAccountList()
+	output, err := OutputFromFlags(cmd)
 	if err != nil {
-		log.Fatal("Unable to retrieve account information:", err.Error())
+		log.Fatal(err)
 	}
 
+	// before the account list, refreshing it puts the default credentials in the environment
 	callerIdentity, err := getCallerIdentity(context.TODO())
 	if err != nil {
-		log.Fatal("Unable to retrieve aws identity:", err.Error())
+		log.Fatal("Unable to retrieve aws identity: ", err.Error())
 	}
 
-	out, err := whoami(callerIdentity, accountList)
+	accountList, err := getAccountList()
 	if err != nil {
-		log.Fatal(err)
+		exitOnError(fmt.Errorf("Unable to retrieve account information: %w", err))
 	}
 
-	out.Print(format)
+	printOutput(output, whoami(callerIdentity, accountList))
 }
 
 type callerIdentity struct {
+	Arn     string
+	Type    string // assumed-role, sso, federated-user, user or root
 	Account string
 	Role    string
 	User    string
+
+	Source     string
+	CacheFile  string
+	Expiration *time.Time
 }
 
 type whoamiOutput struct {
-	AccountName string `json:"AccountName"`
-	AccountID   string `json:"AccountID"`
-	Domain      string `json:"Domain"`
-	Environment string `json:"Environment"`
-	Quality     string `json:"Quality"`
-	Role        string `json:"Role"`
-	User        string `json:"User"`
+	AccountName string     `json:"AccountName"`
+	AccountID   string     `json:"AccountID"`
+	Domain      string     `json:"Domain"`
+	Environment string     `json:"Environment"`
+	Quality     string     `json:"Quality"`
+	Role        string     `json:"Role"`
+	User        string     `json:"User"`
+	Arn         string     `json:"Arn"`
+	Type        string     `json:"Type"`
+	Source      string     `json:"Source"`
+	CacheFile   string     `json:"CacheFile,omitempty"`
+	Expiration  *time.Time `json:"Expiration,omitempty"`
+}
+
+func (o whoamiOutput) Records() any {
+	return o
 }
 
-func (o whoamiOutput) Print(format string) {
-	switch format {
-	case "json":
-		jsonData, _ := json.MarshalIndent(o, "", "  ")
-		fmt.Printf("%s\n", jsonData)
-	case "text":
-		t := table.NewWriter()
-		t.SetOutputMirror(os.Stdout)
-		t.AppendHeader(table.Row{"Domain", "Envionment", "Quality", "Role", "User"})
-		t.AppendRow(table.Row{
-			o.Domain,
-			o.Environment,
-			o.Quality,
-			o.Role,
-			o.User,
-		})
-		t.Render()
-	default:
-		fmt.Printf("format %s is unsupported...", format)
-		os.Exit(1)
+func (o whoamiOutput) Table() table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Domain", "Environment", "Quality", "Role", "User", "Source", "Expiration"})
+	domain := o.Domain
+	if domain == "" {
+		domain = o.AccountName
+	}
+	source := o.Source
+	if o.CacheFile != "" {
+		source += " (" + o.CacheFile + ")"
+	}
+	expiration := "-"
+	if o.Expiration != nil {
+		expiration = fmt.Sprintf("%s (%s)", o.Expiration.Local().Format(time.DateTime), time.Until(*o.Expiration).Round(time.Second))
 	}
+	t.AppendRow(table.Row{
+		domain,
+		o.Environment,
+		o.Quality,
+		o.Role,
+		o.User,
+		source,
+		expiration,
+	})
+	return t
 }
 
 func getCallerIdentity(ctx context.Context) (callerIdentity, error) {
@@ -82,39 +103,136 @@ func getCallerIdentity(ctx context.Context) (callerIdentity, error) {
 	if err != nil {
 		return callerIdentity{}, err
 	}
+	if cfg.Region == "" {
+		cfg.Region = DefaultRegion
+	}
 
-	client := sts.NewFromConfig(cfg)
-	out, err := client.GetCallerIdentity(context.TODO(), &sts.GetCallerIdentityInput{})
+	creds, err := cfg.Credentials.Retrieve(ctx)
 	if err != nil {
-		return callerIdentity{}, nil
+		return callerIdentity{}, err
 	}
 
-	matches := assumedRoleRegex.FindStringSubmatch(aws.ToString(out.Arn))
-	if len(matches) != 4 {
-		return callerIdentity{}, fmt.Errorf("Unable to parse caller identity from arn: %s", aws.ToString(out.Arn))
+	client := sts.NewFromConfig(cfg, func(o *sts.Options) {
+		if stsEndpoint != "" {
+			o.BaseEndpoint = aws.String(stsEndpoint)
+		}
+	})
+	out, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return callerIdentity{}, err
 	}
 
-	return callerIdentity{
-		Account: matches[1],
-		Role:    matches[2],
-		User:    matches[3],
-	}, nil
+	ci, err := parseCallerArn(aws.ToString(out.Arn))
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	ci.Source = credentialSource()
+	if status, ok := findCacheStatus(creds.AccessKeyID); ok {
+		ci.CacheFile = status.File
+		ci.Expiration = status.Expiration
+	} else if creds.CanExpire {
+		ci.Expiration = &creds.Expires
+	}
+	return ci, nil
 }
 
-func whoami(ci callerIdentity, al AccountList) (whoamiOutput, error) {
+// parseCallerArn handles every identity sts:GetCallerIdentity returns, in any partition:
+//
+//	arn:aws:sts::111111111111:assumed-role/Administrator/jane
+//	arn:aws:sts::111111111111:assumed-role/AWSReservedSSO_ReadOnly_0123456789abcdef/jane@example.com
+//	arn:aws:sts::111111111111:federated-user/jane
+//	arn:aws:iam::111111111111:user/path/to/jane
+//	arn:aws:iam::111111111111:root
+func parseCallerArn(callerArn string) (callerIdentity, error) {
+	parsed, err := arn.Parse(callerArn)
+	if err != nil {
+		return callerIdentity{}, fmt.Errorf("Unable to parse caller identity from arn %s: %w", callerArn, err)
+	}
+	ci := callerIdentity{Arn: callerArn, Account: parsed.AccountID}
+
+	kind, rest, _ := strings.Cut(parsed.Resource, "/")
+	switch {
+	case parsed.Service == "sts" && kind == "assumed-role":
+		role, session, ok := strings.Cut(rest, "/")
+		if !ok || role == "" || session == "" {
+			break
+		}
+		ci.Type, ci.Role, ci.User = "assumed-role", role, session
+		if matches := ssoRoleRegex.FindStringSubmatch(role); matches != nil {
+			ci.Type, ci.Role = "sso", matches[1]
+		}
+		return ci, nil
+	case parsed.Service == "sts" && kind == "federated-user" && rest != "":
+		ci.Type, ci.User = "federated-user", rest
+		return ci, nil
+	case parsed.Service == "iam" && kind == "user" && rest != "":
+		// users may have a path, the name is the last segment
+		ci.Type, ci.User = "user", rest[strings.LastIndex(rest, "/")+1:]
+		return ci, nil
+	case parsed.Service == "iam" && parsed.Resource == "root":
+		ci.Type, ci.User = "root", "root"
+		return ci, nil
+	}
+	return callerIdentity{}, fmt.Errorf("Unable to parse caller identity from arn: %s", callerArn)
+}
+
+// credentialSource describes where the AWS SDK found credentials, in the order of its default chain
+func credentialSource() string {
+	switch {
+	case os.Getenv("AWS_ACCESS_KEY_ID") != "":
+		return "env"
+	case os.Getenv("AWS_PROFILE") != "":
+		return "AWS_PROFILE=" + os.Getenv("AWS_PROFILE")
+	case os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI") != "" || os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI") != "":
+		return "container"
+	}
+	return "default profile"
+}
+
+// findCacheStatus returns the quikstrate cache file holding accessKeyId, if any
+func findCacheStatus(accessKeyId string) (cacheStatus, bool) {
+	// like status, whoami must not create the encryption key or migrate plaintext files
+	saved := cacheStore
+	cacheStore = readOnlyCacheStore(cacheStore)
+	defer func() { cacheStore = saved }()
+
+	statuses, err := getCacheStatuses()
+	if err != nil || accessKeyId == "" {
+		return cacheStatus{}, false
+	}
+	for _, status := range statuses {
+		if status.Type == "accounts" {
+			continue
+		}
+		if creds, err := getCredsFromFile(status.File); err == nil && creds.AccessKeyId == accessKeyId {
+			return status, true
+		}
+	}
+	return cacheStatus{}, false
+}
+
+// whoami adds the account's name and tags to ci, identities outside the account list are still shown
+func whoami(ci callerIdentity, al AccountList) whoamiOutput {
+	out := whoamiOutput{
+		AccountID:  ci.Account,
+		Role:       ci.Role,
+		User:       ci.User,
+		Arn:        ci.Arn,
+		Type:       ci.Type,
+		Source:     ci.Source,
+		CacheFile:  ci.CacheFile,
+		Expiration: ci.Expiration,
+	}
 	for _, account := range al.Accounts {
 		if account.Id == ci.Account {
-			return whoamiOutput{
-				AccountName: account.Name,
-				Role:        ci.Role,
-				User:        ci.User,
-				AccountID:   ci.Account,
-				// optional values
-				Environment: account.Tags["Environment"],
-				Domain:      account.Tags["Domain"],
-				Quality:     account.Tags["Quality"],
-			}, nil
+			out.AccountName = account.Name
+			// optional values
+			out.Environment = account.Tags["Environment"]
+			out.Domain = account.Tags["Domain"]
+			out.Quality = account.Tags["Quality"]
+			return out
 		}
 	}
-	return whoamiOutput{}, fmt.Errorf("No matching account found for %+v", ci)
+	log.Printf("account %s is not in the substrate account list, try \"%s accounts --refresh\"", ci.Account, binaryName)
+	return out
 }
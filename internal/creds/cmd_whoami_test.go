@@ -0,0 +1,147 @@
+package creds
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseCallerArn(t *testing.T) {
+	tests := []struct {
+		name    string
+		arn     string
+		want    callerIdentity
+		wantErr bool
+	}{
+		{
+			name: "assumed role",
+			arn:  "arn:aws:sts::111111111111:assumed-role/Administrator/jane",
+			want: callerIdentity{Type: "assumed-role", Account: "111111111111", Role: "Administrator", User: "jane"},
+		},
+		{
+			name: "sso permission set",
+			arn:  "arn:aws:sts::111111111111:assumed-role/AWSReservedSSO_ReadOnly_0123456789abcdef/jane@example.com",
+			want: callerIdentity{Type: "sso", Account: "111111111111", Role: "ReadOnly", User: "jane@example.com"},
+		},
+		{
+			name: "sso permission set with underscores",
+			arn:  "arn:aws:sts::111111111111:assumed-role/AWSReservedSSO_Data_Engineer_0123456789abcdef/jane",
+			want: callerIdentity{Type: "sso", Account: "111111111111", Role: "Data_Engineer", User: "jane"},
+		},
+		{
+			name: "not quite sso",
+			arn:  "arn:aws:sts::111111111111:assumed-role/AWSReservedSSO_ReadOnly/jane",
+			want: callerIdentity{Type: "assumed-role", Account: "111111111111", Role: "AWSReservedSSO_ReadOnly", User: "jane"},
+		},
+		{
+			name: "federated user",
+			arn:  "arn:aws:sts::111111111111:federated-user/jane",
+			want: callerIdentity{Type: "federated-user", Account: "111111111111", User: "jane"},
+		},
+		{
+			name: "iam user",
+			arn:  "arn:aws:iam::111111111111:user/jane",
+			want: callerIdentity{Type: "user", Account: "111111111111", User: "jane"},
+		},
+		{
+			name: "pathed iam user",
+			arn:  "arn:aws:iam::111111111111:user/engineering/platform/jane",
+			want: callerIdentity{Type: "user", Account: "111111111111", User: "jane"},
+		},
+		{
+			name: "root",
+			arn:  "arn:aws:iam::111111111111:root",
+			want: callerIdentity{Type: "root", Account: "111111111111", User: "root"},
+		},
+		{
+			name: "govcloud",
+			arn:  "arn:aws-us-gov:sts::222222222222:assumed-role/Auditor/jane",
+			want: callerIdentity{Type: "assumed-role", Account: "222222222222", Role: "Auditor", User: "jane"},
+		},
+		{
+			name: "china",
+			arn:  "arn:aws-cn:iam::222222222222:user/jane",
+			want: callerIdentity{Type: "user", Account: "222222222222", User: "jane"},
+		},
+		{name: "not an arn", arn: "jane", wantErr: true},
+		{name: "empty", arn: "", wantErr: true},
+		{name: "assumed role without session", arn: "arn:aws:sts::111111111111:assumed-role/Administrator", wantErr: true},
+		{name: "federated user without name", arn: "arn:aws:sts::111111111111:federated-user/", wantErr: true},
+		{name: "iam role", arn: "arn:aws:iam::111111111111:role/Administrator", wantErr: true},
+		{name: "other service", arn: "arn:aws:s3:::bucket", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseCallerArn(tt.arn)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseCallerArn(%q) = %+v, want an error", tt.arn, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.want.Arn = tt.arn
+			if got != tt.want {
+				t.Errorf("parseCallerArn(%q) = %+v, want %+v", tt.arn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWhoami(t *testing.T) {
+	accounts := AccountList{Accounts: []Account{
+		{Id: "111111111111", Name: "api-prod", Tags: map[string]string{"Environment": "prod", "Domain": "api", "Quality": "gamma"}},
+	}}
+
+	got := whoami(callerIdentity{Type: "assumed-role", Account: "111111111111", Role: "Auditor", User: "jane"}, accounts)
+	if got.AccountName != "api-prod" || got.Environment != "prod" || got.Domain != "api" || got.Quality != "gamma" || got.Role != "Auditor" {
+		t.Errorf("whoami() = %+v", got)
+	}
+
+	// identities outside the account list are still shown
+	got = whoami(callerIdentity{Type: "root", Account: "999999999999", User: "root"}, accounts)
+	if got.AccountID != "999999999999" || got.AccountName != "" || got.Type != "root" {
+		t.Errorf("whoami() outside the account list = %+v", got)
+	}
+}
+
+func TestFindCacheStatusIsReadOnly(t *testing.T) {
+	useTestCredsDir(t)
+	store := &encryptedStore{keyFile: filepath.Join(CredsDir, "cache.key"), saltFile: filepath.Join(CredsDir, "cache.salt")}
+	cacheStore = store
+
+	// plaintext caches from before encryption was turned on
+	roleFile := RoleData{"prod", "api", "gamma", "Auditor"}.GetFilename()
+	for file, accessKeyId := range map[string]string{DefaultCredsFile: "AKIADEFAULT", roleFile: "AKIAROLE"} {
+		data, err := json.Marshal(testCredentials(accessKeyId))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, ok := findCacheStatus("AKIAROLE")
+	if !ok || status.File != roleFile {
+		t.Errorf("findCacheStatus(AKIAROLE) = %+v, %t, want %s", status, ok, roleFile)
+	}
+	if _, ok := findCacheStatus("AKIAOTHER"); ok {
+		t.Error("findCacheStatus found a key that isn't cached")
+	}
+	if _, err := os.Stat(store.keyFile); !os.IsNotExist(err) {
+		t.Errorf("findCacheStatus created %s", store.keyFile)
+	}
+	for _, file := range []string{DefaultCredsFile, roleFile} {
+		if data, _ := os.ReadFile(file); bytes.HasPrefix(data, encryptedMagic) {
+			t.Errorf("findCacheStatus migrated %s", file)
+		}
+	}
+	if cacheStore != CacheStore(store) {
+		t.Error("findCacheStatus left the read only store in place")
+	}
+}
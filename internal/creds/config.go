@@ -0,0 +1,370 @@
+package creds
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/metronome-industries/quikstrate/internal/terraform"
+	"sigs.k8s.io/yaml"
+)
+
+const repoConfigName = ".quikstrate.yaml"
+
+var (
+	// ConfigFile is the user config, overridden per repo by the nearest .quikstrate.yaml
+	ConfigFile = getenv("QUIKSTRATE_CONFIG", filepath.Join(CredsDir, "config.yaml"))
+
+	DefaultConsoleURL = "https://gnome.house/accounts?number={{.AccountId}}&role={{.Role}}"
+	// DefaultFederationURL is the AWS sign-in endpoint, QUIKSTRATE_FEDERATION_ENDPOINT points it at a local stand-in
+	DefaultFederationURL  = getenv("QUIKSTRATE_FEDERATION_ENDPOINT", "https://signin.aws.amazon.com/federation")
+	DefaultDestinationURL = "https://console.aws.amazon.com/"
+	// DefaultSwitchRoleURL is the commercial partition's console page that switches the signed-in session into a role
+	DefaultSwitchRoleURL = "https://signin.aws.amazon.com/switchrole"
+
+	// Settings is the effective config: the compiled-in defaults merged with ConfigFiles
+	Settings Config
+	// ConfigFiles are the config files that were found, in the order they were merged
+	ConfigFiles []string
+
+	// accountsTTL is how long the cached account list is used before it is refreshed, 0 never refreshes
+	accountsTTL time.Duration
+
+	configErr error
+)
+
+// Config is the schema of config.yaml and .quikstrate.yaml.  Environments are merged by name
+// (fields left empty keep their previous value), every other list replaces the one before it.
+type Config struct {
+	Region         string                 `json:"region,omitempty"`
+	AccountsTTL    string                 `json:"accounts_ttl,omitempty"`
+	Environments   map[string]Environment `json:"environments,omitempty"`
+	Domains        []string               `json:"domains,omitempty"`
+	SpecialDomains []string               `json:"special_domains,omitempty"`
+	Clusters       []ClusterSpec          `json:"clusters,omitempty"`
+	Console        ConsoleConfig          `json:"console,omitempty"`
+	EKS            EKSConfig              `json:"eks,omitempty"`
+	Policy         PolicyConfig           `json:"policy,omitempty"`
+	Drift          DriftConfig            `json:"drift,omitempty"`
+}
+
+type ConsoleConfig struct {
+	// AccountURL is a text/template given .AccountId, .Environment, .Domain, .Quality and .Role
+	AccountURL string `json:"account_url,omitempty"`
+	// FederationURL and DestinationURL are used by the console command, SwitchRoleURL by the accounts'
+	// switch-role links, eg. for GovCloud or China partitions
+	FederationURL  string `json:"federation_url,omitempty"`
+	DestinationURL string `json:"destination_url,omitempty"`
+	SwitchRoleURL  string `json:"switch_role_url,omitempty"`
+}
+
+// validate requires https for the endpoints the console command sends credentials and sign-in
+// tokens to, plain http is only allowed to a local stand-in
+func (c ConsoleConfig) validate() error {
+	if err := validateEndpoint(c.FederationURL); err != nil {
+		return fmt.Errorf("invalid console.federation_url: %w", err)
+	}
+	if err := validateEndpoint(c.DestinationURL); err != nil {
+		return fmt.Errorf("invalid console.destination_url: %w", err)
+	}
+	if err := validateEndpoint(c.SwitchRoleURL); err != nil {
+		return fmt.Errorf("invalid console.switch_role_url: %w", err)
+	}
+	return nil
+}
+
+func validateEndpoint(endpoint string) error {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Host == "":
+		return fmt.Errorf("%q has no host", endpoint)
+	case u.Scheme == "https":
+		return nil
+	case u.Scheme == "http" && isLoopback(u.Hostname()):
+		return nil
+	}
+	return fmt.Errorf("%q must be https (http is only allowed to localhost)", endpoint)
+}
+
+func isLoopback(host string) bool {
+	return host == "localhost" || host == "127.0.0.1" || host == "::1"
+}
+
+// EKSConfig filters the kube contexts configure creates, by context name (eg. prod-graphql) globs
+type EKSConfig struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+type DriftConfig struct {
+	SkipPatterns []string `json:"skip_patterns,omitempty"`
+}
+
+func init() {
+	Settings = Config{
+		Region:         DefaultRegion,
+		AccountsTTL:    "24h",
+		Environments:   EnvironmentMap,
+		Domains:        Domains,
+		SpecialDomains: specialDomains,
+		Clusters:       Clusters,
+		Console: ConsoleConfig{
+			AccountURL:     DefaultConsoleURL,
+			FederationURL:  DefaultFederationURL,
+			DestinationURL: DefaultDestinationURL,
+			SwitchRoleURL:  DefaultSwitchRoleURL,
+		},
+		Policy: DefaultPolicy,
+		Drift:  DriftConfig{SkipPatterns: terraform.DefaultSkipPatterns},
+	}
+
+	repoConfig, _ := findRepoConfig()
+	if Settings, ConfigFiles, configErr = loadConfig(Settings, ConfigFile, repoConfig); configErr != nil {
+		return
+	}
+	if _, err := template.New("console").Parse(Settings.Console.AccountURL); err != nil {
+		configErr = fmt.Errorf("invalid console.account_url: %w", err)
+		return
+	}
+	if configErr = Settings.Console.validate(); configErr != nil {
+		return
+	}
+	for _, name := range sortedKeys(Settings.Environments) {
+		if color := Settings.Environments[name].Color; color != "" && !hexColor.MatchString(color) {
+			configErr = fmt.Errorf("invalid environments.%s.color %q, expected a hex RGB value like f2b0a9", name, color)
+			return
+		}
+	}
+	var err error
+	if accountsTTL, err = time.ParseDuration(Settings.AccountsTTL); err != nil {
+		configErr = fmt.Errorf("invalid accounts_ttl: %w", err)
+		return
+	}
+	if privilegedCacheLifetime, breakGlassLifetime, err = Settings.Policy.parse(); err != nil {
+		configErr = err
+		return
+	}
+
+	DefaultRegion = Settings.Region
+	EnvironmentMap = Settings.Environments
+	Domains = Settings.Domains
+	specialDomains = Settings.SpecialDomains
+	Clusters = Settings.Clusters
+	terraform.DefaultSkipPatterns = Settings.Drift.SkipPatterns
+}
+
+// loadConfig merges userFile then repoFile (either may be missing, or empty) over defaults.  The repo
+// file comes with whatever repo is checked out, so it may not set any of userOnlyKeys.
+func loadConfig(defaults Config, userFile, repoFile string) (Config, []string, error) {
+	settings := defaults
+	var files []string
+	for _, file := range []string{userFile, repoFile} {
+		if file == "" {
+			continue
+		}
+		config, err := readConfig(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return defaults, nil, err
+		}
+		if keys := config.userOnlyKeys(); file == repoFile && len(keys) > 0 {
+			return defaults, nil, fmt.Errorf("%s sets %s, which can only be set in %s", file, strings.Join(keys, ", "), userFile)
+		}
+		settings = settings.merge(config)
+		files = append(files, file)
+	}
+	if err := checkAliases(settings.Environments); err != nil {
+		return defaults, nil, err
+	}
+	return settings, files, nil
+}
+
+// checkAliases rejects an alias that names another environment, or is shared by two, either would
+// make what it resolves to depend on the order the environments are walked in
+func checkAliases(environments map[string]Environment) error {
+	owners := map[string]string{}
+	for _, name := range sortedKeys(environments) {
+		owners[name] = name
+	}
+	for _, name := range sortedKeys(environments) {
+		for _, alias := range environments[name].Aliases {
+			if owner, ok := owners[alias]; ok && owner != name {
+				return fmt.Errorf("environments.%s.aliases: %q already refers to %s", name, alias, owner)
+			}
+			owners[alias] = name
+		}
+	}
+	return nil
+}
+
+// userOnlyKeys are the keys set in c that a repo's .quikstrate.yaml may not override: the break-glass
+// policy, which environment (and account) a profile resolves to and its default role, and the URLs
+// credentials and links are sent to
+func (c Config) userOnlyKeys() []string {
+	var keys []string
+	for _, name := range sortedKeys(c.Environments) {
+		env := c.Environments[name]
+		if env.Aliases != nil {
+			keys = append(keys, fmt.Sprintf("environments.%s.aliases", name))
+		}
+		if env.DefaultQuality != "" {
+			keys = append(keys, fmt.Sprintf("environments.%s.default_quality", name))
+		}
+		if env.DefaultRole != "" {
+			keys = append(keys, fmt.Sprintf("environments.%s.default_role", name))
+		}
+	}
+	if c.Console.AccountURL != "" {
+		keys = append(keys, "console.account_url")
+	}
+	if c.Console.FederationURL != "" {
+		keys = append(keys, "console.federation_url")
+	}
+	if c.Console.DestinationURL != "" {
+		keys = append(keys, "console.destination_url")
+	}
+	if c.Console.SwitchRoleURL != "" {
+		keys = append(keys, "console.switch_role_url")
+	}
+	if c.Policy.Privileged != nil {
+		keys = append(keys, "policy.privileged")
+	}
+	if c.Policy.CacheLifetime != "" {
+		keys = append(keys, "policy.cache_lifetime")
+	}
+	if c.Policy.ApprovalLifetime != "" {
+		keys = append(keys, "policy.approval_lifetime")
+	}
+	return keys
+}
+
+func readConfig(file string) (config Config, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err = yaml.UnmarshalStrict(data, &config); err != nil {
+		err = fmt.Errorf("unable to parse %s: %w", file, err)
+	}
+	return
+}
+
+// findRepoConfig walks up from the working directory looking for a .quikstrate.yaml
+func findRepoConfig() (string, bool) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	for {
+		file := filepath.Join(dir, repoConfigName)
+		// ~/.quikstrate.yaml would otherwise apply everywhere under $HOME, that's what config.yaml is for
+		if _, err := os.Stat(file); err == nil && dir != home {
+			return file, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func (c Config) merge(o Config) Config {
+	if o.Region != "" {
+		c.Region = o.Region
+	}
+	if o.AccountsTTL != "" {
+		c.AccountsTTL = o.AccountsTTL
+	}
+	if o.Environments != nil {
+		environments := make(map[string]Environment, len(c.Environments))
+		for name, env := range c.Environments {
+			environments[name] = env
+		}
+		for name, env := range o.Environments {
+			environments[name] = environments[name].merge(name, env)
+		}
+		c.Environments = environments
+	}
+	if o.Domains != nil {
+		c.Domains = o.Domains
+	}
+	if o.SpecialDomains != nil {
+		c.SpecialDomains = o.SpecialDomains
+	}
+	if o.Clusters != nil {
+		c.Clusters = o.Clusters
+	}
+	if o.Console.AccountURL != "" {
+		c.Console.AccountURL = o.Console.AccountURL
+	}
+	if o.Console.FederationURL != "" {
+		c.Console.FederationURL = o.Console.FederationURL
+	}
+	if o.Console.DestinationURL != "" {
+		c.Console.DestinationURL = o.Console.DestinationURL
+	}
+	if o.Console.SwitchRoleURL != "" {
+		c.Console.SwitchRoleURL = o.Console.SwitchRoleURL
+	}
+	if o.EKS.Allow != nil {
+		c.EKS.Allow = o.EKS.Allow
+	}
+	if o.EKS.Deny != nil {
+		c.EKS.Deny = o.EKS.Deny
+	}
+	if o.Policy.Privileged != nil {
+		c.Policy.Privileged = o.Policy.Privileged
+	}
+	if o.Policy.CacheLifetime != "" {
+		c.Policy.CacheLifetime = o.Policy.CacheLifetime
+	}
+	if o.Policy.ApprovalLifetime != "" {
+		c.Policy.ApprovalLifetime = o.Policy.ApprovalLifetime
+	}
+	if o.Drift.SkipPatterns != nil {
+		c.Drift.SkipPatterns = o.Drift.SkipPatterns
+	}
+	return c
+}
+
+func (e Environment) merge(name string, o Environment) Environment {
+	e.Name = name
+	if o.Aliases != nil {
+		e.Aliases = o.Aliases
+	}
+	if o.DefaultQuality != "" {
+		e.DefaultQuality = o.DefaultQuality
+	}
+	if o.DefaultRole != "" {
+		e.DefaultRole = o.DefaultRole
+	}
+	if o.Color != "" {
+		e.Color = o.Color
+	}
+	return e
+}
+
+// consoleURL renders the console.account_url template for an account
+func consoleURL(account Account, role string) string {
+	tmpl := template.Must(template.New("console").Parse(Settings.Console.AccountURL))
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, struct {
+		AccountId, Environment, Domain, Quality, Role string
+	}{account.Id, account.Tags["Environment"], account.Tags["Domain"], account.Tags["Quality"], role})
+	if err != nil {
+		return ""
+	}
+	return buf.String()
+}
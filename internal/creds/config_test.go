@@ -0,0 +1,180 @@
+package creds
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testDefaults() Config {
+	return Config{
+		Region:      "us-west-2",
+		AccountsTTL: "24h",
+		Environments: map[string]Environment{
+			"prod": {Name: "prod", Aliases: []string{"prd"}, DefaultQuality: "gamma", DefaultRole: "Auditor", Color: "f2b0a9"},
+		},
+		Domains: []string{"api"},
+		Console: ConsoleConfig{AccountURL: DefaultConsoleURL, FederationURL: DefaultFederationURL, DestinationURL: DefaultDestinationURL},
+		Policy:  DefaultPolicy,
+	}
+}
+
+func TestConfigMerge(t *testing.T) {
+	merged := testDefaults().merge(Config{
+		Region: "us-east-1",
+		Environments: map[string]Environment{
+			"prod":    {DefaultQuality: "delta"},
+			"sandbox": {DefaultQuality: "alpha", DefaultRole: "Administrator"},
+		},
+		Domains: []string{},
+		Policy:  PolicyConfig{CacheLifetime: "5m"},
+	})
+
+	if merged.Region != "us-east-1" {
+		t.Errorf("Region = %q, want us-east-1", merged.Region)
+	}
+	if merged.AccountsTTL != "24h" {
+		t.Errorf("AccountsTTL = %q, an unset key should keep the default", merged.AccountsTTL)
+	}
+	wantProd := Environment{Name: "prod", Aliases: []string{"prd"}, DefaultQuality: "delta", DefaultRole: "Auditor", Color: "f2b0a9"}
+	if got := merged.Environments["prod"]; !reflect.DeepEqual(got, wantProd) {
+		t.Errorf("prod = %+v, want %+v", got, wantProd)
+	}
+	if got := merged.Environments["sandbox"]; got.Name != "sandbox" || got.DefaultRole != "Administrator" {
+		t.Errorf("sandbox = %+v, want a new environment", got)
+	}
+	if len(merged.Domains) != 0 {
+		t.Errorf("Domains = %v, an empty list should replace the default", merged.Domains)
+	}
+	if merged.Policy.CacheLifetime != "5m" || merged.Policy.ApprovalLifetime != "1h" || len(merged.Policy.Privileged) != 1 {
+		t.Errorf("Policy = %+v, want only cache_lifetime replaced", merged.Policy)
+	}
+	if len(testDefaults().Environments) != 1 {
+		t.Error("merge modified the defaults")
+	}
+}
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	file := filepath.Join(dir, name)
+	if err := os.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	userFile := writeConfig(t, dir, "config.yaml", "region: eu-west-1\npolicy:\n  cache_lifetime: 10m\nconsole:\n  account_url: https://example.com/{{.AccountId}}\n")
+
+	tests := []struct {
+		name    string
+		repo    string
+		wantErr string
+	}{
+		{"overridable keys", "region: us-east-2\ndomains: [api, billing]\neks:\n  deny: ['*-sandbox']\nenvironments:\n  prod:\n    color: aabbcc\n", ""},
+		{"empty privileged list", "policy:\n  privileged: []\n", "policy.privileged"},
+		{"lifetimes", "policy:\n  cache_lifetime: 24h\n  approval_lifetime: 720h\n", "policy.cache_lifetime, policy.approval_lifetime"},
+		{"hijack an alias", "environments:\n  prod:\n    aliases: [stg]\n", "environments.prod.aliases"},
+		{"default quality", "environments:\n  prod:\n    default_quality: delta\n", "environments.prod.default_quality"},
+		{"default role", "environments:\n  prod:\n    default_role: Administrator\n", "environments.prod.default_role"},
+		{"federation url", "console:\n  federation_url: https://evil.example.com/federation\n", "console.federation_url"},
+		{"switch role url", "console:\n  switch_role_url: https://evil.example.com/switchrole\n", "console.switch_role_url"},
+		{"account url", "console:\n  account_url: https://evil.example.com/\n", "console.account_url"},
+		{"unknown key", "regoin: us-east-1\n", "unknown field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoFile := writeConfig(t, t.TempDir(), repoConfigName, tt.repo)
+			settings, files, err := loadConfig(testDefaults(), userFile, repoFile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("loadConfig error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(files, []string{userFile, repoFile}) {
+				t.Errorf("files = %v", files)
+			}
+			if settings.Region != "us-east-2" || settings.Policy.CacheLifetime != "10m" || settings.Console.AccountURL != "https://example.com/{{.AccountId}}" {
+				t.Errorf("settings = %+v", settings)
+			}
+			if settings.Environments["prod"].Color != "aabbcc" || settings.Environments["prod"].DefaultRole != "Auditor" {
+				t.Errorf("prod = %+v", settings.Environments["prod"])
+			}
+		})
+	}
+}
+
+func TestLoadConfigMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	settings, files, err := loadConfig(testDefaults(), filepath.Join(dir, "config.yaml"), "")
+	if err != nil || len(files) != 0 || !reflect.DeepEqual(settings, testDefaults()) {
+		t.Errorf("loadConfig = %+v, %v, %v, want the defaults", settings, files, err)
+	}
+}
+
+func TestLoadConfigRejectsCollidingAliases(t *testing.T) {
+	defaults := testDefaults()
+	defaults.Environments["staging"] = Environment{Name: "staging", Aliases: []string{"staging", "stg"}, DefaultQuality: "alpha"}
+
+	tests := []struct {
+		name    string
+		user    string
+		wantErr string
+	}{
+		{"own name", "environments:\n  prod:\n    aliases: [prod, prd, production]\n", ""},
+		{"another environment's alias", "environments:\n  prod:\n    aliases: [prd, stg]\n", `environments.staging.aliases: "stg" already refers to prod`},
+		{"another environment's name", "environments:\n  prod:\n    aliases: [prd, staging]\n", `environments.prod.aliases: "staging" already refers to staging`},
+		{"new environment", "environments:\n  sandbox:\n    aliases: [sbx, prd]\n", `environments.sandbox.aliases: "prd" already refers to prod`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userFile := writeConfig(t, t.TempDir(), "config.yaml", tt.user)
+			_, _, err := loadConfig(defaults, userFile, "")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadConfig error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRepoConfigCannotHijackStaging(t *testing.T) {
+	useTestEnvironments(t)
+	EnvironmentMap["staging"] = Environment{Name: "staging", Aliases: []string{"staging", "stg"}, DefaultQuality: "alpha", DefaultRole: "Administrator"}
+	defaults := testDefaults()
+	defaults.Environments = EnvironmentMap
+
+	repoFile := writeConfig(t, t.TempDir(), repoConfigName, "environments:\n  prod:\n    aliases: [stg]\n")
+	if _, _, err := loadConfig(defaults, "", repoFile); err == nil {
+		t.Fatal("a repo config could alias prod as stg")
+	}
+	environment, domain, quality, role, err := parseProfile("stg-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := NewRoleData(environment, domain, quality, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Environment != "staging" || resolved.Quality != "alpha" || resolved.Role != "Administrator" {
+		t.Errorf("stg-api resolved to %+v, want staging", resolved)
+	}
+
+	// an environment's own name wins over any alias
+	EnvironmentMap["prod"] = Environment{Name: "prod", Aliases: []string{"prd", "staging"}, DefaultQuality: "gamma", DefaultRole: "Auditor"}
+	if env, _ := resolveEnvironment("staging"); env != "staging" {
+		t.Errorf("resolveEnvironment(staging) = %s, want staging", env)
+	}
+}
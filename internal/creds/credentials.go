@@ -1,19 +1,19 @@
 package creds
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"time"
-
-	"github.com/bitfield/script"
 )
 
 const defaultRefreshTrigger = 5 * time.Minute
 
+var errCorruptCache = errors.New("corrupt credentials cache")
+
 type Credentials struct {
 	AccessKeyId     string    `json:"AccessKeyId"`
 	SecretAccessKey string    `json:"SecretAccessKey"`
@@ -22,22 +22,12 @@ type Credentials struct {
 	Version         int       `json:"Version"`
 }
 
-func (c Credentials) Print(format string) {
-	switch format {
-	case "json":
-		jsonData, _ := json.MarshalIndent(c, "", "  ")
-		fmt.Printf("%s\n", jsonData)
-	case "export":
-		switch getShell() {
-		case "fish":
-			fmt.Printf(" set -x AWS_ACCESS_KEY_ID \"%s\"; set -x AWS_SECRET_ACCESS_KEY \"%s\"; set -x AWS_SESSION_TOKEN \"%s\"\n", c.AccessKeyId, c.SecretAccessKey, c.SessionToken)
-		default:
-			fmt.Printf(" export AWS_ACCESS_KEY_ID=\"%s\" AWS_SECRET_ACCESS_KEY=\"%s\" AWS_SESSION_TOKEN=\"%s\"\n", c.AccessKeyId, c.SecretAccessKey, c.SessionToken)
-		}
-	default:
-		fmt.Printf("format %s is unsupported...", format)
-		os.Exit(1)
+func (c Credentials) Print(format string, options PrintOptions) {
+	out, err := c.Format(format, options)
+	if err != nil {
+		log.Fatal(err)
 	}
+	fmt.Println(out)
 }
 
 func (c Credentials) Write(file string) error {
@@ -45,7 +35,7 @@ func (c Credentials) Write(file string) error {
 		return errors.New("cannot write empty credentials")
 	}
 	jsonData, _ := json.MarshalIndent(c, "", "  ")
-	return os.WriteFile(file, jsonData, 0644)
+	return cacheStore.Write(file, jsonData)
 }
 
 func (c Credentials) SetEnv() error {
@@ -58,6 +48,14 @@ func (c Credentials) SetEnv() error {
 	return nil
 }
 
+// validate catches truncated or hand edited cache files
+func (c Credentials) validate() error {
+	if c.AccessKeyId == "" || c.SecretAccessKey == "" || c.SessionToken == "" || c.Expiration.IsZero() {
+		return errCorruptCache
+	}
+	return nil
+}
+
 func (c Credentials) needsRefresh() bool {
 	if time.Now().Add(defaultRefreshTrigger).After(c.Expiration) {
 		return true
@@ -66,56 +64,92 @@ func (c Credentials) needsRefresh() bool {
 }
 
 func getCredsFromFile(file string) (Credentials, error) {
-	jsonFile, err := os.Open(file)
-	if err != nil {
-		return Credentials{}, err
-	}
-	defer jsonFile.Close()
-
-	byteValue, err := io.ReadAll(jsonFile)
+	byteValue, err := cacheStore.Read(file)
 	if err != nil {
 		return Credentials{}, err
 	}
 
 	var creds Credentials
-	err = json.Unmarshal(byteValue, &creds)
-	return creds, err
+	if err = json.Unmarshal(byteValue, &creds); err != nil {
+		return Credentials{}, fmt.Errorf("%w: %s", errCorruptCache, err)
+	}
+	return creds, creds.validate()
 }
 
+// refreshCredentials returns the cached credentials in file, fetching new ones if they are
+// missing, corrupt or expiring.  Concurrent callers (eg. kubectl, aws and terraform all invoking
+// the credential_process at once) serialize on a lock and reuse whatever the first one fetched.
 func refreshCredentials(role RoleData, file string) (Credentials, error) {
-	creds, _ := getCredsFromFile(file)
+	creds, err := getCredsFromFile(file)
+	if err == nil && !creds.needsRefresh() {
+		audit(role, true, creds)
+		return creds, nil
+	}
 
-	if creds.needsRefresh() {
-		return getAndWriteCredentials(role, file)
+	unlock, err := lockFile(file)
+	if err != nil {
+		return Credentials{}, err
 	}
-	return creds, nil
+	defer unlock()
+
+	// another process may have refreshed the file while we waited for the lock
+	creds, err = getCredsFromFile(file)
+	if err == nil && !creds.needsRefresh() {
+		audit(role, true, creds)
+		return creds, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("discarding unreadable cache %s: %s", file, err)
+	}
+	return fetchAndWriteCredentials(role, file)
 }
 
 func getCredentials(role RoleData) (creds Credentials, err error) {
-	var cmd string
+	ctx := context.TODO()
 	if (role == RoleData{}) {
-		cmd = "substrate credentials --format json --force"
-	} else {
-		ensureAWSEnvSet()
-		cmd = fmt.Sprintf("substrate assume-role --environment %s --domain %s --quality %s --role %s --format json", role.Environment, role.Domain, role.Quality, role.Role)
-	}
-	log.Print("running: ", cmd)
-	byteValue, err := script.NewPipe().WithStderr(os.Stderr).Exec(cmd).Bytes()
-	if err != nil {
-		return
+		return substrate.Credentials(ctx)
 	}
 
-	err = json.Unmarshal(byteValue, &creds)
-	return
+	// only on a cache miss, cache hits (every credential_process and refresh tick) skip the account list
+	if err := checkRole(role); err != nil {
+		return Credentials{}, err
+	}
+	ensureAWSEnvSet()
+	if nativeAssume {
+		creds, err = assumeRoleNative(ctx, role)
+		if err == nil {
+			return
+		}
+		log.Printf("native assume role failed, falling back to substrate: %s", err)
+	}
+	return substrate.AssumeRole(ctx, role)
 }
 
+// getAndWriteCredentials always fetches new credentials, ignoring the cache
 func getAndWriteCredentials(role RoleData, file string) (Credentials, error) {
+	unlock, err := lockFile(file)
+	if err != nil {
+		return Credentials{}, err
+	}
+	defer unlock()
+	return fetchAndWriteCredentials(role, file)
+}
+
+// fetchAndWriteCredentials expects the caller to hold the lock for file
+func fetchAndWriteCredentials(role RoleData, file string) (Credentials, error) {
 	creds, err := getCredentials(role)
 	if err != nil {
 		return Credentials{}, err
 	}
+	if err = creds.validate(); err != nil {
+		return Credentials{}, fmt.Errorf("substrate returned invalid credentials: %w", err)
+	}
+	creds = clampExpiration(role, creds)
 
 	log.Printf("writing credentials to %s (expiring in %s)\n", file, creds.Expiration.Sub(time.Now()).Round(time.Minute).String())
-	creds.Write(file)
-	return creds, err
+	if err = creds.Write(file); err != nil {
+		log.Printf("unable to cache credentials: %s", err)
+	}
+	audit(role, false, creds)
+	return creds, nil
 }
@@ -0,0 +1,115 @@
+package creds
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeSubstrate counts calls and hands out credentials expiring in an hour
+type fakeSubstrate struct {
+	accounts                []Account
+	credentials, assumeRole int
+	accountList             int
+}
+
+func (f *fakeSubstrate) Credentials(ctx context.Context) (Credentials, error) {
+	f.credentials++
+	return testCredentials("AKIADEFAULT"), nil
+}
+
+func (f *fakeSubstrate) AssumeRole(ctx context.Context, role RoleData) (Credentials, error) {
+	f.assumeRole++
+	return testCredentials("AKIAROLE"), nil
+}
+
+func (f *fakeSubstrate) AccountList(ctx context.Context) ([]Account, error) {
+	f.accountList++
+	return f.accounts, nil
+}
+
+func (f *fakeSubstrate) Version(ctx context.Context) (string, error) {
+	return "substrate 2024.01", nil
+}
+
+func testCredentials(accessKeyId string) Credentials {
+	return Credentials{
+		AccessKeyId:     accessKeyId,
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour),
+		Version:         1,
+	}
+}
+
+// useTestCredsDir points the cache, audit log, approvals and substrate at a temp dir and a fake
+func useTestCredsDir(t *testing.T) *fakeSubstrate {
+	t.Helper()
+	dir := t.TempDir()
+	fake := &fakeSubstrate{accounts: []Account{
+		{Id: "111111111111", Name: "api-prod", Status: "ACTIVE", Tags: map[string]string{"Environment": "prod", "Domain": "api", "Quality": "gamma"}},
+		{Id: "222222222222", Name: "api-staging", Status: "ACTIVE", Tags: map[string]string{"Environment": "staging", "Domain": "api", "Quality": "alpha"}},
+	}}
+	saved := []*string{&CredsDir, &DefaultCredsFile, &accountsFile, &auditFile, &breakGlassFile}
+	values := make([]string, len(saved))
+	for i, p := range saved {
+		values[i] = *p
+	}
+	savedStore, savedSubstrate, savedNative := cacheStore, substrate, nativeAssume
+	t.Cleanup(func() {
+		for i, p := range saved {
+			*p = values[i]
+		}
+		cacheStore, substrate, nativeAssume = savedStore, savedSubstrate, savedNative
+	})
+
+	CredsDir = dir
+	DefaultCredsFile = filepath.Join(dir, "credentials.json")
+	accountsFile = filepath.Join(dir, "accounts.json")
+	auditFile = filepath.Join(dir, "audit.jsonl")
+	breakGlassFile = filepath.Join(dir, "break-glass.json")
+	cacheStore = plaintextStore{}
+	substrate = fake
+	nativeAssume = false
+	for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN"} {
+		t.Setenv(key, "")
+	}
+	return fake
+}
+
+func TestGetRoleCredentialsChecksRoleOnlyOnMiss(t *testing.T) {
+	fake := useTestCredsDir(t)
+	role := RoleData{"staging", "api", "alpha", "Administrator"}
+
+	if _, err := getRoleCredentials(role, false); err != nil {
+		t.Fatal(err)
+	}
+	if fake.assumeRole != 1 || fake.accountList != 1 {
+		t.Fatalf("miss: assumeRole = %d, accountList = %d, want 1 and 1", fake.assumeRole, fake.accountList)
+	}
+
+	// drop the account list, a cache hit must not need (or fetch) it
+	if err := cacheStore.Write(accountsFile, []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := getRoleCredentials(role, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fake.assumeRole != 1 || fake.accountList != 1 {
+		t.Errorf("hits: assumeRole = %d, accountList = %d, want 1 and 1", fake.assumeRole, fake.accountList)
+	}
+}
+
+func TestGetRoleCredentialsUnknownAccount(t *testing.T) {
+	fake := useTestCredsDir(t)
+	_, err := getRoleCredentials(RoleData{"staging", "billing", "alpha", "Administrator"}, false)
+	if err == nil {
+		t.Fatal("getRoleCredentials succeeded for an account that doesn't exist")
+	}
+	if fake.assumeRole != 0 {
+		t.Errorf("substrate was asked to assume a role with no account")
+	}
+}
@@ -0,0 +1,133 @@
+package creds
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/eks/types"
+)
+
+// eksEndpoint overrides the EKS endpoint, eg. a local stand-in for testing
+var eksEndpoint = os.Getenv("QUIKSTRATE_EKS_ENDPOINT")
+
+// KubeCluster is a cluster to configure a kube context for
+type KubeCluster struct {
+	ClusterSpec
+	Environment string
+}
+
+// Context is the kube context (and user) alias, eg. prod-graphql
+func (c KubeCluster) Context() string {
+	return fmt.Sprintf("%s-%s", c.Environment, c.Name)
+}
+
+// Profile is the AWS_PROFILE kubectl authenticates with
+func (c KubeCluster) Profile() string {
+	return fmt.Sprintf("%s-%s", c.Environment, c.Domain)
+}
+
+// staticClusters pairs the configured Clusters with every environment in matrix that has their domain
+func staticClusters(matrix AccountMatrix) []KubeCluster {
+	var clusters []KubeCluster
+	for _, environment := range matrix.Environments() {
+		for _, cluster := range Clusters {
+			if _, ok := matrix[environment][cluster.Domain]; ok {
+				clusters = append(clusters, KubeCluster{ClusterSpec: cluster, Environment: environment})
+			}
+		}
+	}
+	return clusters
+}
+
+// discoverClusters lists the ACTIVE EKS clusters in every account in matrix, using each environment's
+// default role.  Accounts that can't be listed are logged and skipped.
+func discoverClusters(ctx context.Context, matrix AccountMatrix, region string) []KubeCluster {
+	var clusters []KubeCluster
+	for _, environment := range matrix.Environments() {
+		for _, domain := range matrix.Domains(environment) {
+			quality, ok := matrix.Quality(environment, domain)
+			if !ok {
+				continue
+			}
+			role := RoleData{Environment: environment, Domain: domain, Quality: quality, Role: EnvironmentMap[environment].DefaultRole}
+			names, err := listClusters(ctx, role, region)
+			if err != nil {
+				log.Printf("Unable to list EKS clusters in %s: %s", role.Profile(), err)
+				continue
+			}
+			for _, name := range names {
+				clusters = append(clusters, KubeCluster{ClusterSpec: ClusterSpec{Name: name, Domain: domain}, Environment: environment})
+			}
+		}
+	}
+	return clusters
+}
+
+func listClusters(ctx context.Context, role RoleData, region string) ([]string, error) {
+	creds, err := getRoleCredentials(role, false)
+	if err != nil {
+		return nil, err
+	}
+
+	client := eks.New(eks.Options{
+		Region:      region,
+		Credentials: credentials.NewStaticCredentialsProvider(creds.AccessKeyId, creds.SecretAccessKey, creds.SessionToken),
+	}, func(o *eks.Options) {
+		if eksEndpoint != "" {
+			o.BaseEndpoint = aws.String(eksEndpoint)
+		}
+	})
+
+	var names []string
+	paginator := eks.NewListClustersPaginator(client, &eks.ListClustersInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range page.Clusters {
+			out, err := client.DescribeCluster(ctx, &eks.DescribeClusterInput{Name: aws.String(name)})
+			if err != nil {
+				return nil, err
+			}
+			// creating clusters have no endpoint yet, deleting ones are about to go away
+			if out.Cluster.Status != types.ClusterStatusActive && out.Cluster.Status != types.ClusterStatusUpdating {
+				log.Printf("Skipping EKS cluster %s in %s, it is %s", name, role.Profile(), out.Cluster.Status)
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// filterClusters keeps the clusters whose context matches an allow pattern (all of them when there
+// are none) and no deny pattern, patterns are path.Match globs such as "prod-*"
+func filterClusters(clusters []KubeCluster, allow, deny []string) []KubeCluster {
+	var filtered []KubeCluster
+	for _, cluster := range clusters {
+		if len(allow) > 0 && !matchAny(allow, cluster.Context()) {
+			continue
+		}
+		if matchAny(deny, cluster.Context()) {
+			continue
+		}
+		filtered = append(filtered, cluster)
+	}
+	return filtered
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
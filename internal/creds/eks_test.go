@@ -0,0 +1,143 @@
+package creds
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// useTestEKS points listClusters at a stand-in EKS with two pages of clusters in every account
+func useTestEKS(t *testing.T) *int {
+	t.Helper()
+	pages := map[string]map[string]any{
+		"":  {"clusters": []string{"graphql", "creating"}, "nextToken": "2"},
+		"2": {"clusters": []string{"rating", "deleting", "updating"}},
+	}
+	statuses := map[string]string{"graphql": "ACTIVE", "creating": "CREATING", "rating": "ACTIVE", "deleting": "DELETING", "updating": "UPDATING"}
+	var listed int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/clusters" {
+			listed++
+			page, ok := pages[r.URL.Query().Get("nextToken")]
+			if !ok {
+				t.Errorf("unknown nextToken %q", r.URL.Query().Get("nextToken"))
+			}
+			json.NewEncoder(w).Encode(page)
+			return
+		}
+		name := strings.TrimPrefix(r.URL.Path, "/clusters/")
+		status, ok := statuses[name]
+		if !ok {
+			w.Header().Set("X-Amzn-Errortype", "ResourceNotFoundException")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "No cluster found for name: " + name})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"cluster": map[string]string{"name": name, "status": status}})
+	}))
+	t.Cleanup(server.Close)
+
+	saved := eksEndpoint
+	t.Cleanup(func() { eksEndpoint = saved })
+	eksEndpoint = server.URL
+	return &listed
+}
+
+func TestListClusters(t *testing.T) {
+	useTestCredsDir(t)
+	listed := useTestEKS(t)
+
+	names, err := listClusters(context.Background(), RoleData{"prod", "api", "gamma", "Auditor"}, "us-west-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// creating and deleting clusters are skipped, updating ones still have an endpoint
+	if want := []string{"graphql", "rating", "updating"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("listClusters() = %v, want %v", names, want)
+	}
+	if *listed != 2 {
+		t.Errorf("ListClusters was called %d times, want a call per page", *listed)
+	}
+}
+
+func TestDiscoverClusters(t *testing.T) {
+	fake := useTestCredsDir(t)
+	useTestEnvironments(t)
+	EnvironmentMap["staging"] = Environment{Name: "staging", DefaultQuality: "alpha", DefaultRole: "Administrator"}
+	useTestEKS(t)
+	// prod-lambda has two qualities, neither the default, so there is no account to discover it in
+	fake.accounts = append(fake.accounts, Account{Id: "333333333333", Status: "ACTIVE", Tags: map[string]string{"Environment": "prod", "Domain": "lambda", "Quality": "delta"}},
+		Account{Id: "444444444444", Status: "ACTIVE", Tags: map[string]string{"Environment": "prod", "Domain": "lambda", "Quality": "epsilon"}})
+
+	var contexts []string
+	for _, cluster := range discoverClusters(context.Background(), AccountList{Accounts: fake.accounts}.Matrix(), "us-west-2") {
+		contexts = append(contexts, cluster.Context()+" "+cluster.Profile())
+	}
+	want := []string{
+		"prod-graphql prod-api", "prod-rating prod-api", "prod-updating prod-api",
+		"staging-graphql staging-api", "staging-rating staging-api", "staging-updating staging-api",
+	}
+	if !reflect.DeepEqual(contexts, want) {
+		t.Errorf("discoverClusters() = %v, want %v", contexts, want)
+	}
+	if fake.assumeRole != 2 {
+		t.Errorf("assumeRole = %d, want one per account listed", fake.assumeRole)
+	}
+}
+
+func TestDiscoverClustersSkipsFailingAccounts(t *testing.T) {
+	fake := useTestCredsDir(t)
+	useTestEnvironments(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Amzn-Errortype", "AccessDeniedException")
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message":"not authorized to perform: eks:ListClusters"}`))
+	}))
+	defer server.Close()
+	saved := eksEndpoint
+	t.Cleanup(func() { eksEndpoint = saved })
+	eksEndpoint = server.URL
+
+	if clusters := discoverClusters(context.Background(), AccountList{Accounts: fake.accounts}.Matrix(), "us-west-2"); len(clusters) != 0 {
+		t.Errorf("discoverClusters() = %v, want none", clusters)
+	}
+}
+
+func TestFilterClusters(t *testing.T) {
+	var clusters []KubeCluster
+	for _, env := range []string{"prod", "staging", "sandbox"} {
+		for _, name := range []string{"graphql", "rating"} {
+			clusters = append(clusters, KubeCluster{ClusterSpec: ClusterSpec{Name: name, Domain: "api"}, Environment: env})
+		}
+	}
+	tests := []struct {
+		name  string
+		allow []string
+		deny  []string
+		want  []string
+	}{
+		{name: "everything", want: []string{"prod-graphql", "prod-rating", "staging-graphql", "staging-rating", "sandbox-graphql", "sandbox-rating"}},
+		{name: "allow", allow: []string{"prod-*"}, want: []string{"prod-graphql", "prod-rating"}},
+		{name: "allow several", allow: []string{"prod-graphql", "*-rating"}, want: []string{"prod-graphql", "prod-rating", "staging-rating", "sandbox-rating"}},
+		{name: "deny", deny: []string{"sandbox-*"}, want: []string{"prod-graphql", "prod-rating", "staging-graphql", "staging-rating"}},
+		{name: "deny wins over allow", allow: []string{"*-graphql"}, deny: []string{"staging-*", "sandbox-graphql"}, want: []string{"prod-graphql"}},
+		{name: "no match", allow: []string{"dev-*"}},
+		{name: "bad pattern matches nothing", allow: []string{"prod-["}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, cluster := range filterClusters(clusters, tt.allow, tt.deny) {
+				got = append(got, cluster.Context())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filterClusters(%v, %v) = %v, want %v", tt.allow, tt.deny, got, tt.want)
+			}
+		})
+	}
+}
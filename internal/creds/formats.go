@@ -0,0 +1,172 @@
+package creds
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// CredentialFormats are the formats supported by Credentials.Format
+var CredentialFormats = []string{"json", "export", "dotenv", "docker", "powershell", "nushell", "csh", "github-env", "aws-credentials"}
+
+// PrintOptions are the extras some credential formats include
+type PrintOptions struct {
+	// Region adds AWS_REGION/AWS_DEFAULT_REGION (or region in aws-credentials), omitted when empty
+	Region string
+	// Profile names the aws-credentials section
+	Profile string
+	// Shell selects the export syntax
+	Shell string
+}
+
+// validateCredentialFormat fails fast, before any credentials are fetched
+func validateCredentialFormat(format string) error {
+	if !slices.Contains(CredentialFormats, format) {
+		return fmt.Errorf("format %s is unsupported, expected one of %s", format, strings.Join(CredentialFormats, ", "))
+	}
+	return nil
+}
+
+type envVar struct {
+	Key   string
+	Value string
+}
+
+func (c Credentials) envVars(region string) []envVar {
+	vars := []envVar{
+		{"AWS_ACCESS_KEY_ID", c.AccessKeyId},
+		{"AWS_SECRET_ACCESS_KEY", c.SecretAccessKey},
+		{"AWS_SESSION_TOKEN", c.SessionToken},
+	}
+	if region != "" {
+		vars = append(vars, envVar{"AWS_REGION", region}, envVar{"AWS_DEFAULT_REGION", region})
+	}
+	return vars
+}
+
+// Format renders the credentials in one of CredentialFormats
+func (c Credentials) Format(format string, options PrintOptions) (string, error) {
+	vars := c.envVars(options.Region)
+	var lines []string
+
+	switch format {
+	case "json":
+		jsonData, _ := json.MarshalIndent(c, "", "  ")
+		return string(jsonData), nil
+	case "export":
+		return c.Export(options.Shell, options.Region), nil
+	case "powershell", "nushell", "csh":
+		return c.Export(format, options.Region), nil
+	case "dotenv":
+		for _, v := range vars {
+			lines = append(lines, fmt.Sprintf("%s=%s", v.Key, doubleQuote(v.Value)))
+		}
+	case "docker":
+		// docker --env-file takes values literally, there is no quoting or escaping
+		for _, v := range vars {
+			if strings.ContainsAny(v.Value, "\r\n") {
+				return "", fmt.Errorf("%s contains a newline, which docker env files can't represent", v.Key)
+			}
+			lines = append(lines, fmt.Sprintf("%s=%s", v.Key, v.Value))
+		}
+	case "github-env":
+		// https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions#multiline-strings
+		for _, v := range vars {
+			if strings.ContainsAny(v.Value, "\r\n") {
+				delimiter := githubEnvDelimiter()
+				// the value would end the block early
+				for strings.Contains(v.Value, delimiter) {
+					delimiter = githubEnvDelimiter()
+				}
+				lines = append(lines, fmt.Sprintf("%s<<%s\n%s\n%s", v.Key, delimiter, v.Value, delimiter))
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s=%s", v.Key, v.Value))
+		}
+	case "aws-credentials":
+		// the ini format has no quoting or escaping either
+		for _, v := range vars {
+			if strings.ContainsAny(v.Value, "\r\n") {
+				return "", fmt.Errorf("%s contains a newline, which aws credentials files can't represent", v.Key)
+			}
+		}
+		profile := options.Profile
+		if profile == "" {
+			profile = "default"
+		}
+		lines = append(lines,
+			fmt.Sprintf("[%s]", profile),
+			fmt.Sprintf("aws_access_key_id = %s", c.AccessKeyId),
+			fmt.Sprintf("aws_secret_access_key = %s", c.SecretAccessKey),
+			fmt.Sprintf("aws_session_token = %s", c.SessionToken),
+		)
+		if options.Region != "" {
+			lines = append(lines, fmt.Sprintf("region = %s", options.Region))
+		}
+	default:
+		return "", validateCredentialFormat(format)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// githubEnvDelimiter ends a multiline github-env value, a var for tests
+var githubEnvDelimiter = func() string {
+	return "ghadelimiter_" + randomToken()[:16]
+}
+
+// Export returns a (leading space, so it stays out of shell history) command that sets the credentials in shell
+func (c Credentials) Export(shell, region string) string {
+	var cmds []string
+	for _, v := range c.envVars(region) {
+		switch shell {
+		case "fish":
+			cmds = append(cmds, fmt.Sprintf("set -x %s %s", v.Key, fishQuote(v.Value)))
+		case "nu", "nushell":
+			cmds = append(cmds, fmt.Sprintf("$env.%s = %s", v.Key, nuQuote(v.Value)))
+		case "pwsh", "powershell":
+			cmds = append(cmds, fmt.Sprintf("$env:%s = %s", v.Key, powershellQuote(v.Value)))
+		case "csh", "tcsh":
+			cmds = append(cmds, fmt.Sprintf("setenv %s %s", v.Key, cshQuote(v.Value)))
+		default:
+			cmds = append(cmds, fmt.Sprintf("%s=%s", v.Key, posixQuote(v.Value)))
+		}
+	}
+
+	switch shell {
+	case "fish", "nu", "nushell", "pwsh", "powershell", "csh", "tcsh":
+		return " " + strings.Join(cmds, "; ")
+	default:
+		return " export " + strings.Join(cmds, " ")
+	}
+}
+
+// posixQuote single quotes s for sh, bash and zsh
+func posixQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// fishQuote single quotes s for fish, which allows escaped quotes inside single quotes
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// powershellQuote single quotes s for PowerShell, where quotes are escaped by doubling them
+func powershellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// cshQuote single quotes s for csh/tcsh, history expansion (!) applies even inside quotes
+func cshQuote(s string) string {
+	return "'" + strings.NewReplacer("'", `'\''`, "!", `\!`, "\n", "\\\n").Replace(s) + "'"
+}
+
+// doubleQuote double quotes s for dotenv files, escaping $ so it isn't expanded
+func doubleQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`).Replace(s) + `"`
+}
+
+// nuQuote double quotes s for nushell, which only interpolates $"..." strings
+func nuQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`).Replace(s) + `"`
+}
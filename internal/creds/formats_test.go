@@ -0,0 +1,152 @@
+package creds
+
+import (
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// trickyValue has everything a shell or env file could expand, end a string on, or split a line at
+const trickyValue = "a'b\"c$HOME`id`\n!x\\y"
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name  string
+		quote func(string) string
+		in    string
+		want  string
+	}{
+		{"posix plain", posixQuote, "abc", `'abc'`},
+		{"posix", posixQuote, trickyValue, "'a'\\''b\"c$HOME`id`\n!x\\y'"},
+		{"fish", fishQuote, trickyValue, "'a\\'b\"c$HOME`id`\n!x\\\\y'"},
+		{"powershell", powershellQuote, trickyValue, "'a''b\"c$HOME`id`\n!x\\y'"},
+		{"csh", cshQuote, trickyValue, "'a'\\''b\"c$HOME`id`\\\n\\!x\\y'"},
+		{"dotenv", doubleQuote, trickyValue + "\r", "\"a'b\\\"c\\$HOME`id`\\n!x\\\\y\\r\""},
+		{"nushell", nuQuote, trickyValue + "\r", "\"a'b\\\"c$HOME`id`\\n!x\\\\y\\r\""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quote(tt.in); got != tt.want {
+				t.Errorf("quote(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func trickyCredentials() Credentials {
+	creds := testCredentials("AKIATEST")
+	creds.SecretAccessKey = trickyValue
+	return creds
+}
+
+func TestCredentialsFormat(t *testing.T) {
+	savedDelimiter := githubEnvDelimiter
+	t.Cleanup(func() { githubEnvDelimiter = savedDelimiter })
+	// the first delimiter appears in the value, so the next one has to be used
+	delimiters := []string{"ghadelimiter_x", "ghadelimiter_y"}
+	githubEnvDelimiter = func() string {
+		delimiter := delimiters[0]
+		delimiters = delimiters[1:]
+		return delimiter
+	}
+	creds := trickyCredentials()
+	creds.SessionToken = "token\nghadelimiter_x"
+
+	tests := []struct {
+		format  string
+		options PrintOptions
+		want    []string
+		wantErr string
+	}{
+		{format: "export", options: PrintOptions{Shell: "bash", Region: "us-west-2"}, want: []string{
+			" export AWS_ACCESS_KEY_ID='AKIATEST' AWS_SECRET_ACCESS_KEY=" + posixQuote(trickyValue),
+			"AWS_REGION='us-west-2' AWS_DEFAULT_REGION='us-west-2'",
+		}},
+		{format: "export", options: PrintOptions{Shell: "fish"}, want: []string{" set -x AWS_ACCESS_KEY_ID 'AKIATEST'; set -x AWS_SECRET_ACCESS_KEY " + fishQuote(trickyValue) + ";"}},
+		{format: "export", options: PrintOptions{Shell: "tcsh"}, want: []string{"; setenv AWS_SECRET_ACCESS_KEY " + cshQuote(trickyValue) + ";"}},
+		{format: "powershell", want: []string{" $env:AWS_ACCESS_KEY_ID = 'AKIATEST'; $env:AWS_SECRET_ACCESS_KEY = " + powershellQuote(trickyValue) + ";"}},
+		{format: "nushell", want: []string{" $env.AWS_ACCESS_KEY_ID = \"AKIATEST\"; $env.AWS_SECRET_ACCESS_KEY = " + nuQuote(trickyValue) + ";"}},
+		{format: "csh", want: []string{"setenv AWS_SECRET_ACCESS_KEY " + cshQuote(trickyValue)}},
+		{format: "dotenv", options: PrintOptions{Region: "us-west-2"}, want: []string{
+			"AWS_ACCESS_KEY_ID=\"AKIATEST\"\nAWS_SECRET_ACCESS_KEY=" + doubleQuote(trickyValue) + "\n",
+			"\nAWS_DEFAULT_REGION=\"us-west-2\"",
+		}},
+		{format: "docker", wantErr: "AWS_SECRET_ACCESS_KEY contains a newline"},
+		{format: "aws-credentials", wantErr: "AWS_SECRET_ACCESS_KEY contains a newline"},
+		{format: "github-env", want: []string{
+			"AWS_ACCESS_KEY_ID=AKIATEST\n",
+			"AWS_SECRET_ACCESS_KEY<<ghadelimiter_x\n" + trickyValue + "\nghadelimiter_x\n",
+			"AWS_SESSION_TOKEN<<ghadelimiter_y\ntoken\nghadelimiter_x\nghadelimiter_y",
+		}},
+		{format: "xml", wantErr: "format xml is unsupported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+tt.options.Shell, func(t *testing.T) {
+			got, err := creds.Format(tt.format, tt.options)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Format(%s) error = %v, want %q", tt.format, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("Format(%s) =\n%s\nwant it to contain\n%s", tt.format, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCredentialsFormatLiteral(t *testing.T) {
+	creds := testCredentials("AKIATEST")
+	creds.SecretAccessKey = "a'b\"c$HOME`id`!x\\y"
+
+	// docker env files and aws credentials take values as they are
+	docker, err := creds.Format("docker", PrintOptions{})
+	if err != nil || !strings.Contains(docker, "\nAWS_SECRET_ACCESS_KEY="+creds.SecretAccessKey+"\n") {
+		t.Errorf("Format(docker) = %s, %v", docker, err)
+	}
+	ini, err := creds.Format("aws-credentials", PrintOptions{Profile: "prod-api", Region: "us-west-2"})
+	want := "[prod-api]\naws_access_key_id = AKIATEST\naws_secret_access_key = " + creds.SecretAccessKey + "\naws_session_token = token\nregion = us-west-2"
+	if err != nil || ini != want {
+		t.Errorf("Format(aws-credentials) = %s, %v, want %s", ini, err, want)
+	}
+
+	jsonData, err := trickyCredentials().Format("json", PrintOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Credentials
+	if err := json.Unmarshal([]byte(jsonData), &decoded); err != nil || decoded.SecretAccessKey != trickyValue {
+		t.Errorf("Format(json) round trips to %q, %v", decoded.SecretAccessKey, err)
+	}
+}
+
+// TestExportEval has the shells that are installed evaluate the export, the real test of the quoting
+func TestExportEval(t *testing.T) {
+	for _, shell := range []string{"sh", "bash", "zsh", "fish"} {
+		path, err := exec.LookPath(shell)
+		if err != nil {
+			continue
+		}
+		t.Run(shell, func(t *testing.T) {
+			export := trickyCredentials().Export(shell, "us-west-2")
+			script := export + "\nprintf %s \"$AWS_SECRET_ACCESS_KEY\""
+			if shell == "fish" {
+				script = export + "; printf %s $AWS_SECRET_ACCESS_KEY"
+			}
+			out, err := exec.Command(path, "-c", script).Output()
+			if err != nil {
+				t.Fatalf("%s -c %q: %s", shell, script, err)
+			}
+			if string(out) != trickyValue {
+				t.Errorf("%s evaluated the secret to %q, want %q", shell, out, trickyValue)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package creds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	lockTimeout      = 5 * time.Minute
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// lockFile takes an exclusive advisory lock on "<file>.lock" so only one quikstrate process
+// refreshes a given cache file at a time.  Locks are released by the kernel if the process dies.
+func lockFile(file string) (unlock func(), err error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	lockPath := file + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			f.Close()
+			return nil, fmt.Errorf("unable to lock %s: %w", lockPath, err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("timed out after %s waiting for %s", lockTimeout, lockPath)
+		}
+		time.Sleep(lockPollInterval)
+	}
+
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,178 @@
+package creds
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// AccountMatrix maps environment -> domain -> qualities for every ACTIVE account tagged by substrate
+type AccountMatrix map[string]map[string][]string
+
+// Matrix derives the environment/domain/quality combinations from the account tags
+func (a AccountList) Matrix() AccountMatrix {
+	matrix := AccountMatrix{}
+	for _, account := range a.Accounts {
+		if account.Status != "ACTIVE" {
+			continue
+		}
+		env, domain, quality := account.Tags["Environment"], account.Tags["Domain"], account.Tags["Quality"]
+		if env == "" || domain == "" || quality == "" {
+			continue
+		}
+		if matrix[env] == nil {
+			matrix[env] = map[string][]string{}
+		}
+		if !slices.Contains(matrix[env][domain], quality) {
+			matrix[env][domain] = append(matrix[env][domain], quality)
+			sort.Strings(matrix[env][domain])
+		}
+	}
+	return matrix
+}
+
+func (m AccountMatrix) Environments() []string {
+	return sortedKeys(m)
+}
+
+// Domains returns the domains in environment, or in any environment when it is empty
+func (m AccountMatrix) Domains(environment string) []string {
+	set := map[string][]string{}
+	for env, domains := range m {
+		if environment != "" && env != environment {
+			continue
+		}
+		for domain := range domains {
+			set[domain] = nil
+		}
+	}
+	return sortedKeys(set)
+}
+
+func (m AccountMatrix) Qualities(environment, domain string) []string {
+	return m[environment][domain]
+}
+
+// Quality picks the quality used when none is given: the environment default, or the only one there is
+func (m AccountMatrix) Quality(environment, domain string) (string, bool) {
+	qualities := m.Qualities(environment, domain)
+	if slices.Contains(qualities, EnvironmentMap[environment].DefaultQuality) {
+		return EnvironmentMap[environment].DefaultQuality, true
+	}
+	if len(qualities) == 1 {
+		return qualities[0], true
+	}
+	return "", false
+}
+
+// Check returns an ErrUnknownAccount error listing the valid choices when role has no account
+func (m AccountMatrix) Check(role RoleData) error {
+	switch {
+	case m[role.Environment] == nil:
+		return fmt.Errorf("%w: environment %s has no accounts%s", ErrUnknownAccount, role.Environment, hint(role.Environment, m.Environments()))
+	case m[role.Environment][role.Domain] == nil:
+		return fmt.Errorf("%w: %s has no %s domain%s", ErrUnknownAccount, role.Environment, role.Domain, hint(role.Domain, m.Domains(role.Environment)))
+	case !slices.Contains(m.Qualities(role.Environment, role.Domain), role.Quality):
+		return fmt.Errorf("%w: %s-%s has no %s quality%s", ErrUnknownAccount, role.Environment, role.Domain, role.Quality, hint(role.Quality, m.Qualities(role.Environment, role.Domain)))
+	}
+	return nil
+}
+
+// hint suggests the closest candidate, or lists them all when none is close
+func hint(name string, candidates []string) string {
+	if suggestion := suggest(name, candidates); suggestion != "" {
+		return suggestion
+	}
+	return fmt.Sprintf(", expected one of %s", strings.Join(candidates, ", "))
+}
+
+// checkRole validates role against the account matrix.  The check is skipped, rather than
+// failing the command, when the account list can't be retrieved.
+func checkRole(role RoleData) error {
+	accountList, err := getAccountList()
+	if err != nil {
+		return nil
+	}
+	if accountList.Matrix().Check(role) == nil {
+		return nil
+	}
+	// the cached list may predate the account, refresh it (unless it was just fetched) before giving up
+	if time.Since(accountList.FetchedAt) < time.Minute {
+		return accountList.Matrix().Check(role)
+	}
+	accountList, err = forceRefreshAccounts()
+	if err != nil {
+		return nil
+	}
+	return accountList.Matrix().Check(role)
+}
+
+// cachedMatrix is the matrix from the cached account list, completion must never call substrate
+func cachedMatrix() (AccountMatrix, bool) {
+	accountList, err := readAccountsFile(accountsFile)
+	if err != nil {
+		return nil, false
+	}
+	return accountList.Matrix(), true
+}
+
+func CompleteEnvironments(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if matrix, ok := cachedMatrix(); ok {
+		return matrix.Environments(), cobra.ShellCompDirectiveNoFileComp
+	}
+	return sortedKeys(EnvironmentMap), cobra.ShellCompDirectiveNoFileComp
+}
+
+func CompleteDomains(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if matrix, ok := cachedMatrix(); ok {
+		return matrix.Domains(cmd.Flag("env").Value.String()), cobra.ShellCompDirectiveNoFileComp
+	}
+	return Domains, cobra.ShellCompDirectiveNoFileComp
+}
+
+func CompleteQualities(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	matrix, ok := cachedMatrix()
+	if !ok {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	env, domain := cmd.Flag("env").Value.String(), cmd.Flag("domain").Value.String()
+	if env == "" || domain == "" {
+		var qualities []string
+		for _, domains := range matrix {
+			for _, q := range domains {
+				qualities = append(qualities, q...)
+			}
+		}
+		slices.Sort(qualities)
+		return slices.Compact(qualities), cobra.ShellCompDirectiveNoFileComp
+	}
+	return matrix.Qualities(env, domain), cobra.ShellCompDirectiveNoFileComp
+}
+
+// CompleteProfiles completes the positional profile of assume, eg. prod-api
+func CompleteProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	matrix, ok := cachedMatrix()
+	if !ok || len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var profiles []string
+	for _, env := range matrix.Environments() {
+		for _, domain := range matrix.Domains(env) {
+			profiles = append(profiles, fmt.Sprintf("%s-%s", env, domain))
+		}
+	}
+	return profiles, cobra.ShellCompDirectiveNoFileComp
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,157 @@
+package creds
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// matrixAccounts is an account list with a bit of everything substrate returns
+func matrixAccounts() AccountList {
+	tagged := func(id, status, env, domain, quality string) Account {
+		return Account{Id: id, Status: status, Tags: map[string]string{"Environment": env, "Domain": domain, "Quality": quality}}
+	}
+	return AccountList{Accounts: []Account{
+		tagged("111111111111", "ACTIVE", "prod", "api", "gamma"),
+		tagged("111111111112", "ACTIVE", "prod", "api", "delta"),
+		tagged("111111111113", "ACTIVE", "prod", "static-sites", "gamma"),
+		tagged("222222222222", "ACTIVE", "staging", "api", "alpha"),
+		tagged("222222222223", "ACTIVE", "staging", "lambda", "beta"),
+		tagged("222222222224", "SUSPENDED", "staging", "billing", "alpha"),
+		tagged("333333333333", "ACTIVE", "sandbox", "api", "alpha"),
+		{Id: "444444444444", Status: "ACTIVE", Name: "management"},
+		{Id: "555555555555", Status: "ACTIVE", Name: "audit", Tags: map[string]string{"Domain": "audit"}},
+	}}
+}
+
+func TestAccountListMatrix(t *testing.T) {
+	want := AccountMatrix{
+		"prod":    {"api": {"delta", "gamma"}, "static-sites": {"gamma"}},
+		"staging": {"api": {"alpha"}, "lambda": {"beta"}},
+		"sandbox": {"api": {"alpha"}},
+	}
+	matrix := matrixAccounts().Matrix()
+	if !reflect.DeepEqual(matrix, want) {
+		t.Errorf("Matrix() = %v, want %v (suspended and untagged accounts skipped)", matrix, want)
+	}
+	if got := matrix.Environments(); !reflect.DeepEqual(got, []string{"prod", "sandbox", "staging"}) {
+		t.Errorf("Environments() = %v", got)
+	}
+	if got := matrix.Domains(""); !reflect.DeepEqual(got, []string{"api", "lambda", "static-sites"}) {
+		t.Errorf("Domains(\"\") = %v", got)
+	}
+	if got := matrix.Domains("staging"); !reflect.DeepEqual(got, []string{"api", "lambda"}) {
+		t.Errorf("Domains(staging) = %v", got)
+	}
+}
+
+func TestAccountMatrixQuality(t *testing.T) {
+	useTestEnvironments(t)
+	matrix := matrixAccounts().Matrix()
+	tests := []struct {
+		environment, domain string
+		want                string
+		ok                  bool
+	}{
+		{"prod", "api", "gamma", true},          // the default of several
+		{"prod", "static-sites", "gamma", true}, // the default
+		{"staging", "lambda", "beta", true},     // the only one, not the default
+		{"staging", "api", "alpha", true},
+		{"prod", "billing", "", false},
+		{"dev", "api", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := matrix.Quality(tt.environment, tt.domain)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Quality(%s, %s) = %q, %t, want %q, %t", tt.environment, tt.domain, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// several qualities and none of them the default
+	matrix["prod"]["api"] = []string{"delta", "epsilon"}
+	if got, ok := matrix.Quality("prod", "api"); ok {
+		t.Errorf("Quality(prod, api) = %q, want none of two non-default qualities", got)
+	}
+}
+
+func TestAccountMatrixCheck(t *testing.T) {
+	matrix := matrixAccounts().Matrix()
+	tests := []struct {
+		name    string
+		role    RoleData
+		wantErr string
+	}{
+		{name: "known", role: RoleData{"prod", "api", "delta", "Auditor"}},
+		{name: "dashed domain", role: RoleData{"prod", "static-sites", "gamma", "Auditor"}},
+		{name: "unknown environment", role: RoleData{"prd", "api", "gamma", "Auditor"}, wantErr: `environment prd has no accounts, did you mean "prod"?`},
+		{name: "unknown domain", role: RoleData{"staging", "lamda", "beta", "Auditor"}, wantErr: `staging has no lamda domain, did you mean "lambda"?`},
+		{name: "suspended account", role: RoleData{"staging", "billing", "alpha", "Auditor"}, wantErr: "staging has no billing domain, expected one of api, lambda"},
+		{name: "unknown quality", role: RoleData{"prod", "api", "beta", "Auditor"}, wantErr: "prod-api has no beta quality"},
+		{name: "unmanaged environment", role: RoleData{"management", "management", "alpha", "Auditor"}, wantErr: "environment management has no accounts, expected one of prod, sandbox, staging"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := matrix.Check(tt.role)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrUnknownAccount) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Check(%+v) = %v, want ErrUnknownAccount with %q", tt.role, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiscoverMatrix(t *testing.T) {
+	useTestEnvironments(t)
+	tests := []struct {
+		name         string
+		environments []string
+		domains      []string
+		filterEnvs   bool
+		filterDoms   bool
+		want         AccountMatrix
+	}{
+		{
+			// sandbox isn't a configured environment
+			name: "everything known",
+			want: AccountMatrix{
+				"prod":    {"api": {"delta", "gamma"}, "static-sites": {"gamma"}},
+				"staging": {"api": {"alpha"}, "lambda": {"beta"}},
+			},
+		},
+		{
+			name:         "environments",
+			environments: []string{"staging", "sandbox"},
+			filterEnvs:   true,
+			want:         AccountMatrix{"staging": {"api": {"alpha"}, "lambda": {"beta"}}},
+		},
+		{
+			name:       "domains",
+			domains:    []string{"api", "billing"},
+			filterDoms: true,
+			want:       AccountMatrix{"prod": {"api": {"delta", "gamma"}}, "staging": {"api": {"alpha"}}},
+		},
+		{
+			name:         "unfiltered flags are ignored",
+			environments: []string{"prod"},
+			domains:      []string{"api"},
+			want: AccountMatrix{
+				"prod":    {"api": {"delta", "gamma"}, "static-sites": {"gamma"}},
+				"staging": {"api": {"alpha"}, "lambda": {"beta"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := discoverMatrix(matrixAccounts(), tt.environments, tt.domains, tt.filterEnvs, tt.filterDoms)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("discoverMatrix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package creds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+// OutputFormats are the --format values supported by accounts, whoami, status, audit and config show
+var OutputFormats = []string{"text", "json", "yaml", "csv", "markdown"}
+
+// Printable is a command's output.  JSON and YAML marshal the value itself, text, csv and markdown
+// render Table, and --template is executed for each of Records (or once, when it isn't a slice).
+type Printable interface {
+	Table() table.Writer
+	Records() any
+}
+
+// Output is the --format and --template a command was given
+type Output struct {
+	Format   string
+	Template *template.Template
+}
+
+// OutputFromFlags validates --format and parses --template, so a typo fails before any work is done
+func OutputFromFlags(cmd *cobra.Command) (Output, error) {
+	output := Output{Format: cmd.Flag("format").Value.String()}
+	if text := cmd.Flag("template").Value.String(); text != "" {
+		tmpl, err := template.New("output").Funcs(template.FuncMap{
+			"join":  strings.Join,
+			"upper": strings.ToUpper,
+			"lower": strings.ToLower,
+		}).Parse(text)
+		if err != nil {
+			return output, fmt.Errorf("invalid --template: %w", err)
+		}
+		output.Template = tmpl
+		return output, nil
+	}
+	if !slices.Contains(OutputFormats, output.Format) {
+		return output, fmt.Errorf("format %s is unsupported, expected one of %s", output.Format, strings.Join(OutputFormats, ", "))
+	}
+	return output, nil
+}
+
+// Print writes p to stdout
+func (o Output) Print(p Printable) error {
+	return o.write(os.Stdout, p)
+}
+
+func (o Output) write(w io.Writer, p Printable) error {
+	if o.Template != nil {
+		return o.executeTemplate(w, p.Records())
+	}
+
+	switch o.Format {
+	case "json":
+		jsonData, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\n", jsonData)
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(p)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(w, string(data))
+		return nil
+	}
+
+	t := p.Table()
+	if t == nil {
+		return fmt.Errorf("format %s is unsupported here, use json, yaml or --template", o.Format)
+	}
+	switch o.Format {
+	case "text":
+		fmt.Fprintln(w, t.Render())
+	case "csv":
+		fmt.Fprintln(w, t.RenderCSV())
+	case "markdown":
+		fmt.Fprintln(w, t.RenderMarkdown())
+	default:
+		return fmt.Errorf("format %s is unsupported, expected one of %s", o.Format, strings.Join(OutputFormats, ", "))
+	}
+	return nil
+}
+
+func (o Output) executeTemplate(w io.Writer, records any) error {
+	v := reflect.ValueOf(records)
+	if v.Kind() != reflect.Slice {
+		return o.executeRecord(w, records)
+	}
+	for i := 0; i < v.Len(); i++ {
+		if err := o.executeRecord(w, v.Index(i).Interface()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o Output) executeRecord(w io.Writer, record any) error {
+	if err := o.Template.Execute(w, record); err != nil {
+		return fmt.Errorf("unable to execute --template: %w", err)
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+// printOutput prints p, exiting non-zero on failure
+func printOutput(output Output, p Printable) {
+	if err := output.Print(p); err != nil {
+		log.Fatal(err)
+	}
+}
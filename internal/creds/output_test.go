@@ -0,0 +1,179 @@
+package creds
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+type testRecord struct {
+	Name string `json:"Name"`
+	Id   string `json:"Id"`
+}
+
+type testRecords []testRecord
+
+func (r testRecords) Records() any {
+	return r
+}
+
+func (r testRecords) Table() table.Writer {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Name", "Id"})
+	for _, record := range r {
+		t.AppendRow(table.Row{record.Name, record.Id})
+	}
+	return t
+}
+
+// untabled only supports json, yaml and --template
+type untabled struct {
+	Name string `json:"Name"`
+}
+
+func (u untabled) Records() any {
+	return u
+}
+
+func (u untabled) Table() table.Writer {
+	return nil
+}
+
+// outputCmd has the flags cmd's addOutputFlags adds
+func outputCmd(t *testing.T, format, tmpl string) *cobra.Command {
+	t.Helper()
+	cmd := &cobra.Command{}
+	cmd.Flags().StringP("format", "f", "text", "")
+	cmd.Flags().String("template", "", "")
+	if err := cmd.Flags().Set("format", format); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Flags().Set("template", tmpl); err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestOutputFromFlags(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		template string
+		wantErr  string
+	}{
+		{name: "text", format: "text"},
+		{name: "markdown", format: "markdown"},
+		{name: "unsupported format", format: "xml", wantErr: "format xml is unsupported"},
+		{name: "template ignores the format", format: "xml", template: "{{.Name}}"},
+		{name: "template functions", format: "text", template: `{{upper .Name}} {{lower .Id}} {{join .Tags ","}}`},
+		{name: "bad template", format: "text", template: "{{.Name", wantErr: "invalid --template"},
+		{name: "unknown function", format: "text", template: "{{title .Name}}", wantErr: "invalid --template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := OutputFromFlags(outputCmd(t, tt.format, tt.template))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("OutputFromFlags() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output.Format != tt.format || (output.Template != nil) != (tt.template != "") {
+				t.Errorf("OutputFromFlags() = %+v", output)
+			}
+		})
+	}
+}
+
+func TestOutputPrint(t *testing.T) {
+	records := testRecords{{Name: "api-prod", Id: "111111111111"}, {Name: "api-staging", Id: "222222222222"}}
+	tests := []struct {
+		name      string
+		format    string
+		template  string
+		printable Printable
+		want      string
+		wantErr   string
+	}{
+		{
+			name:   "json",
+			format: "json",
+			want: `[
+  {
+    "Name": "api-prod",
+    "Id": "111111111111"
+  },
+  {
+    "Name": "api-staging",
+    "Id": "222222222222"
+  }
+]
+`,
+		},
+		{
+			name:   "yaml",
+			format: "yaml",
+			want: `- Id: "111111111111"
+  Name: api-prod
+- Id: "222222222222"
+  Name: api-staging
+`,
+		},
+		{name: "csv", format: "csv", want: "Name,Id\napi-prod,111111111111\napi-staging,222222222222\n"},
+		{
+			name:   "markdown",
+			format: "markdown",
+			want: `| Name | Id |
+| --- | --- |
+| api-prod | 111111111111 |
+| api-staging | 222222222222 |
+`,
+		},
+		{name: "text", format: "text"},
+		{name: "template per record", format: "text", template: "{{.Id}} {{upper .Name}}", want: "111111111111 API-PROD\n222222222222 API-STAGING\n"},
+		{name: "template single record", format: "text", template: "{{.Name}}", printable: untabled{Name: "default"}, want: "default\n"},
+		{name: "template error", format: "text", template: "{{.Missing}}", wantErr: "unable to execute --template"},
+		{name: "yaml without a table", format: "yaml", printable: untabled{Name: "default"}, want: "Name: default\n"},
+		{name: "csv without a table", format: "csv", printable: untabled{Name: "default"}, wantErr: "format csv is unsupported here"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := OutputFromFlags(outputCmd(t, tt.format, tt.template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			printable := tt.printable
+			if printable == nil {
+				printable = records
+			}
+
+			var buf bytes.Buffer
+			err = output.write(&buf, printable)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Print() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// text is boxed and upper cases the header, just look for a row
+			if tt.format == "text" && tt.template == "" {
+				if !strings.Contains(buf.String(), "| api-prod    | 111111111111 |") {
+					t.Errorf("Print() =\n%s", buf.String())
+				}
+				return
+			}
+			if buf.String() != tt.want {
+				t.Errorf("Print() =\n%s\nwant\n%s", buf.String(), tt.want)
+			}
+		})
+	}
+}
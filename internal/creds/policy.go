@@ -0,0 +1,217 @@
+package creds
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrBreakGlassRequired = errors.New("privileged role requires break-glass approval")
+
+	DefaultPolicy = PolicyConfig{
+		Privileged:       []PrivilegedRole{{Environment: "prod", Role: "Administrator"}},
+		CacheLifetime:    "15m",
+		ApprovalLifetime: "1h",
+	}
+
+	breakGlassFile = filepath.Join(CredsDir, "break-glass.json")
+
+	// set from Settings.Policy once the config is loaded
+	privilegedCacheLifetime time.Duration
+	breakGlassLifetime      time.Duration
+
+	// confirmations are TTY confirmations, which unlike break-glass approvals only last for this
+	// process (eg. the refresh loop of imds), expiring after breakGlassLifetime all the same
+	confirmations   = map[string]time.Time{}
+	confirmationsMu sync.Mutex
+)
+
+// exit code for a privileged role requested without approval, eg. by credential_process
+const exitBreakGlassRequired = 5
+
+// PolicyConfig marks env/role pairs as privileged.  Privileged credentials are cached for at most
+// CacheLifetime and need a --break-glass approval (valid for ApprovalLifetime) or a TTY confirmation.
+type PolicyConfig struct {
+	Privileged       []PrivilegedRole `json:"privileged,omitempty"`
+	CacheLifetime    string           `json:"cache_lifetime,omitempty"`
+	ApprovalLifetime string           `json:"approval_lifetime,omitempty"`
+}
+
+// PrivilegedRole matches roles by environment and role name, both path.Match globs
+type PrivilegedRole struct {
+	Environment string `json:"environment"`
+	Role        string `json:"role"`
+}
+
+func (p PolicyConfig) parse() (cacheLifetime, approvalLifetime time.Duration, err error) {
+	if cacheLifetime, err = time.ParseDuration(p.CacheLifetime); err != nil {
+		err = fmt.Errorf("invalid policy.cache_lifetime: %w", err)
+		return
+	}
+	if approvalLifetime, err = time.ParseDuration(p.ApprovalLifetime); err != nil {
+		err = fmt.Errorf("invalid policy.approval_lifetime: %w", err)
+	}
+	return
+}
+
+func isPrivileged(role RoleData) bool {
+	for _, p := range Settings.Policy.Privileged {
+		envMatch, _ := path.Match(p.Environment, role.Environment)
+		roleMatch, _ := path.Match(strings.ToLower(p.Role), strings.ToLower(role.Role))
+		if envMatch && roleMatch {
+			return true
+		}
+	}
+	return false
+}
+
+// clampExpiration shortens how long privileged credentials are cached (and handed out) for
+func clampExpiration(role RoleData, creds Credentials) Credentials {
+	if !isPrivileged(role) {
+		return creds
+	}
+	if limit := time.Now().Add(privilegedCacheLifetime); creds.Expiration.After(limit) {
+		creds.Expiration = limit
+	}
+	return creds
+}
+
+type breakGlassApproval struct {
+	Reason     string    `json:"Reason"`
+	User       string    `json:"User"`
+	ApprovedAt time.Time `json:"ApprovedAt"`
+	ExpiresAt  time.Time `json:"ExpiresAt"`
+}
+
+func approvalKey(role RoleData) string {
+	return strings.ToLower(fmt.Sprintf("%s-%s-%s-%s", role.Environment, role.Domain, role.Quality, role.Role))
+}
+
+func readApprovals() map[string]breakGlassApproval {
+	approvals := map[string]breakGlassApproval{}
+	data, err := cacheStore.Read(breakGlassFile)
+	if err != nil {
+		return approvals
+	}
+	if err := json.Unmarshal(data, &approvals); err != nil {
+		log.Printf("discarding unreadable %s: %s", breakGlassFile, err)
+	}
+	return approvals
+}
+
+func recordApproval(role RoleData, reason string) error {
+	unlock, err := lockFile(breakGlassFile)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	now := time.Now()
+	approvals := readApprovals()
+	for key, approval := range approvals {
+		if now.After(approval.ExpiresAt) {
+			delete(approvals, key)
+		}
+	}
+	approvals[approvalKey(role)] = breakGlassApproval{
+		Reason:     reason,
+		User:       sessionName(),
+		ApprovedAt: now,
+		ExpiresAt:  now.Add(breakGlassLifetime),
+	}
+	jsonData, _ := json.MarshalIndent(approvals, "", "  ")
+	return cacheStore.Write(breakGlassFile, jsonData)
+}
+
+// authorizeRole lets non-privileged roles through.  Privileged roles need --break-glass with a
+// --reason (cached for later non-interactive calls), a cached approval, or (when prompt is set
+// and a person is at the terminal) a TTY confirmation.
+func authorizeRole(role RoleData, breakGlass bool, reason string, prompt bool) error {
+	if !isPrivileged(role) {
+		return nil
+	}
+
+	if breakGlass {
+		if strings.TrimSpace(reason) == "" {
+			return errors.New("--break-glass requires a --reason")
+		}
+		log.Printf("break-glass: %s %s for %s (%s)", role.Profile(), role.Role, breakGlassLifetime, reason)
+		return recordApproval(role, reason)
+	}
+
+	err := requireApproval(role)
+	if err == nil || !prompt || !isInteractive() {
+		return err
+	}
+
+	if !confirmAtTerminal(role) {
+		return fmt.Errorf("%s %s not confirmed", role.Profile(), role.Role)
+	}
+	confirmationsMu.Lock()
+	defer confirmationsMu.Unlock()
+	confirmations[approvalKey(role)] = time.Now().Add(breakGlassLifetime)
+	return nil
+}
+
+// confirmAtTerminal asks for the profile name to be typed, a var for tests
+var confirmAtTerminal = func(role RoleData) bool {
+	fmt.Fprintf(os.Stderr, "%s %s is privileged, type %q to continue: ", role.Profile(), role.Role, role.Profile())
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == role.Profile()
+}
+
+// recordConfirmation turns this process' TTY confirmation of role into a break-glass approval, for
+// commands that run quikstrate again without asking (the shell's refresh hook)
+func recordConfirmation(role RoleData, reason string) error {
+	confirmationsMu.Lock()
+	confirmed, ok := confirmations[approvalKey(role)]
+	confirmationsMu.Unlock()
+	if !ok || time.Now().After(confirmed) {
+		return nil
+	}
+	if approval, ok := readApprovals()[approvalKey(role)]; ok && time.Now().Before(approval.ExpiresAt) {
+		return nil
+	}
+	return recordApproval(role, reason)
+}
+
+// requireApproval fails for a privileged role without an unexpired break-glass approval or TTY
+// confirmation.  getRoleCredentials checks it on every call, so long running commands (serve, imds
+// and the shell's refresh hook) stop handing out privileged credentials once the approval lapses.
+func requireApproval(role RoleData) error {
+	if !isPrivileged(role) {
+		return nil
+	}
+	now := time.Now()
+	if approval, ok := readApprovals()[approvalKey(role)]; ok && now.Before(approval.ExpiresAt) {
+		return nil
+	}
+	confirmationsMu.Lock()
+	confirmed, ok := confirmations[approvalKey(role)]
+	confirmationsMu.Unlock()
+	if ok && now.Before(confirmed) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s, run \"%s assume %s/%s/%s/%s --break-glass --reason <why>\" first",
+		ErrBreakGlassRequired, role.Profile(), role.Role, binaryName, role.Environment, role.Domain, role.Quality, role.Role)
+}
+
+// authorizeFromFlags applies authorizeRole with the --break-glass and --reason flags, and (for commands
+// that have it) --no-prompt
+func authorizeFromFlags(cmd *cobra.Command, role RoleData) error {
+	breakGlass, _ := strconv.ParseBool(cmd.Flag("break-glass").Value.String())
+	noPrompt, _ := cmd.Flags().GetBool("no-prompt")
+	return authorizeRole(role, breakGlass, cmd.Flag("reason").Value.String(), !noPrompt)
+}
@@ -0,0 +1,133 @@
+package creds
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// useTestPolicy makes prod Administrator privileged, with the default lifetimes
+func useTestPolicy(t *testing.T) {
+	t.Helper()
+	savedPolicy, savedCache, savedApproval := Settings.Policy, privilegedCacheLifetime, breakGlassLifetime
+	t.Cleanup(func() {
+		Settings.Policy, privilegedCacheLifetime, breakGlassLifetime = savedPolicy, savedCache, savedApproval
+		confirmationsMu.Lock()
+		confirmations = map[string]time.Time{}
+		confirmationsMu.Unlock()
+	})
+	Settings.Policy = DefaultPolicy
+	privilegedCacheLifetime, breakGlassLifetime = 15*time.Minute, time.Hour
+}
+
+func writeApproval(t *testing.T, role RoleData, expiresAt time.Time) {
+	t.Helper()
+	data, _ := json.Marshal(map[string]breakGlassApproval{
+		approvalKey(role): {Reason: "test", ApprovedAt: expiresAt.Add(-time.Hour), ExpiresAt: expiresAt},
+	})
+	if err := cacheStore.Write(breakGlassFile, data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthorizeRole(t *testing.T) {
+	admin := RoleData{"prod", "api", "gamma", "Administrator"}
+	tests := []struct {
+		name               string
+		role               RoleData
+		approval           time.Duration // from now, 0 for none
+		breakGlass         bool
+		reason             string
+		wantErr            bool
+		breakGlassRequired bool
+	}{
+		{name: "not privileged", role: RoleData{"prod", "api", "gamma", "Auditor"}},
+		{name: "other environment", role: RoleData{"staging", "api", "alpha", "Administrator"}},
+		{name: "role case insensitive", role: RoleData{"prod", "api", "gamma", "administrator"}, wantErr: true, breakGlassRequired: true},
+		{name: "no approval", role: admin, wantErr: true, breakGlassRequired: true},
+		{name: "break-glass without reason", role: admin, breakGlass: true, reason: " ", wantErr: true},
+		{name: "break-glass", role: admin, breakGlass: true, reason: "incident"},
+		{name: "approved", role: admin, approval: time.Minute},
+		{name: "approval expired", role: admin, approval: -time.Minute, wantErr: true, breakGlassRequired: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestCredsDir(t)
+			useTestPolicy(t)
+			if tt.approval != 0 {
+				writeApproval(t, tt.role, time.Now().Add(tt.approval))
+			}
+
+			// tests don't run at a terminal, so prompt never asks
+			err := authorizeRole(tt.role, tt.breakGlass, tt.reason, true)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("authorizeRole() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got := errors.Is(err, ErrBreakGlassRequired); got != tt.breakGlassRequired {
+				t.Errorf("authorizeRole() error = %v, want ErrBreakGlassRequired %t", err, tt.breakGlassRequired)
+			}
+			if tt.breakGlass && err == nil {
+				approval, ok := readApprovals()[approvalKey(tt.role)]
+				if !ok || approval.Reason != tt.reason || time.Until(approval.ExpiresAt) <= 59*time.Minute {
+					t.Errorf("break-glass recorded %+v (ok %t)", approval, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestGetRoleCredentialsRequiresUnexpiredApproval(t *testing.T) {
+	fake := useTestCredsDir(t)
+	useTestPolicy(t)
+	admin := RoleData{"prod", "api", "gamma", "Administrator"}
+
+	writeApproval(t, admin, time.Now().Add(time.Minute))
+	creds, err := getRoleCredentials(admin, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(creds.Expiration) > privilegedCacheLifetime {
+		t.Errorf("privileged credentials expire in %s, want at most %s", time.Until(creds.Expiration), privilegedCacheLifetime)
+	}
+
+	// once the approval lapses even the cached credentials are refused, which stops the refresh loops
+	writeApproval(t, admin, time.Now().Add(-time.Minute))
+	if _, err := getRoleCredentials(admin, false); !errors.Is(err, ErrBreakGlassRequired) {
+		t.Fatalf("getRoleCredentials() error = %v, want ErrBreakGlassRequired", err)
+	}
+	if fake.assumeRole != 1 {
+		t.Errorf("assumeRole = %d, want 1", fake.assumeRole)
+	}
+
+	// a TTY confirmation lasts for the process, until breakGlassLifetime
+	confirmations[approvalKey(admin)] = time.Now().Add(time.Minute)
+	if _, err := getRoleCredentials(admin, false); err != nil {
+		t.Errorf("getRoleCredentials() with a confirmation: %s", err)
+	}
+	confirmations[approvalKey(admin)] = time.Now().Add(-time.Minute)
+	if _, err := getRoleCredentials(admin, false); !errors.Is(err, ErrBreakGlassRequired) {
+		t.Errorf("getRoleCredentials() with an expired confirmation error = %v, want ErrBreakGlassRequired", err)
+	}
+}
+
+func TestCredentialHolderDropsLapsedRoles(t *testing.T) {
+	useTestCredsDir(t)
+	useTestPolicy(t)
+	admin := RoleData{"prod", "api", "gamma", "Administrator"}
+	writeApproval(t, admin, time.Now().Add(time.Minute))
+
+	h := newCredentialHolder()
+	if _, err := h.get(admin); err != nil {
+		t.Fatal(err)
+	}
+
+	// the held credentials are still fresh, the approval alone decides
+	writeApproval(t, admin, time.Now().Add(-time.Minute))
+	if _, err := h.get(admin); !errors.Is(err, ErrBreakGlassRequired) {
+		t.Fatalf("get() error = %v, want ErrBreakGlassRequired", err)
+	}
+	if _, ok := h.creds[admin]; ok {
+		t.Error("the holder still refreshes a role whose approval lapsed")
+	}
+}
@@ -0,0 +1,131 @@
+package creds
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// resolveEnvironment returns the environment name for a name or one of its aliases
+func resolveEnvironment(name string) (string, bool) {
+	name = strings.ToLower(name)
+	if _, ok := EnvironmentMap[name]; ok {
+		return name, true
+	}
+	for _, env := range sortedKeys(EnvironmentMap) {
+		if slices.Contains(EnvironmentMap[env].Aliases, name) {
+			return env, true
+		}
+	}
+	return "", false
+}
+
+// environmentNames are the environment names followed by their aliases
+func environmentNames() []string {
+	names := sortedKeys(EnvironmentMap)
+	for _, env := range sortedKeys(EnvironmentMap) {
+		for _, alias := range EnvironmentMap[env].Aliases {
+			if !slices.Contains(names, alias) {
+				names = append(names, alias)
+			}
+		}
+	}
+	return names
+}
+
+// parseProfile splits a positional profile, either an AWS_PROFILE name (prod-api, prd-static-sites)
+// or a path with the quality and role optional (prod/api, prd/api/gamma/Auditor)
+func parseProfile(profile string) (environment, domain, quality, role string, err error) {
+	if strings.Contains(profile, "/") {
+		parts := strings.Split(profile, "/")
+		if len(parts) < 2 || len(parts) > 4 || slices.Contains(parts, "") {
+			err = fmt.Errorf("invalid profile %q, expected <env>/<domain>[/<quality>[/<role>]]", profile)
+			return
+		}
+		parts = append(parts, "", "")
+		return parts[0], parts[1], parts[2], parts[3], nil
+	}
+
+	// domains may contain dashes, so prefer the longest environment (or alias) prefix
+	for _, name := range environmentNames() {
+		if strings.HasPrefix(profile, name+"-") && len(name) > len(environment) {
+			environment = name
+		}
+	}
+	if environment == "" {
+		environment, domain, _ = strings.Cut(profile, "-")
+	} else {
+		domain = strings.TrimPrefix(profile, environment+"-")
+	}
+	if environment == "" || domain == "" {
+		err = fmt.Errorf("invalid profile %q, expected <env>-<domain> or <env>/<domain>[/<quality>[/<role>]]", profile)
+	}
+	return
+}
+
+// roleDataFromFlags builds the RoleData from --env/--domain/--quality/--role, or from a positional
+// profile with --quality and --role filling in what it leaves out
+func roleDataFromFlags(cmd *cobra.Command, args []string) (RoleData, error) {
+	environment := cmd.Flag("env").Value.String()
+	domain := cmd.Flag("domain").Value.String()
+	quality := cmd.Flag("quality").Value.String()
+	role := cmd.Flag("role").Value.String()
+
+	if len(args) > 0 {
+		if cmd.Flag("env").Changed || cmd.Flag("domain").Changed {
+			return RoleData{}, errors.New("use either a profile or --env/--domain, not both")
+		}
+		var profileQuality, profileRole string
+		var err error
+		environment, domain, profileQuality, profileRole, err = parseProfile(args[0])
+		if err != nil {
+			return RoleData{}, err
+		}
+		if profileQuality != "" {
+			quality = profileQuality
+		}
+		if profileRole != "" {
+			role = profileRole
+		}
+	}
+	return NewRoleData(environment, domain, quality, role)
+}
+
+// suggest returns a ", did you mean ...?" hint for the candidate closest to name, if any is close
+func suggest(name string, candidates []string) string {
+	best, bestDistance := "", len(name)/2+2
+	for _, candidate := range candidates {
+		if distance := levenshtein(strings.ToLower(name), strings.ToLower(candidate)); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// levenshtein is the edit distance between a and b, counted in runes
+func levenshtein(x, y string) int {
+	a, b := []rune(x), []rune(y)
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
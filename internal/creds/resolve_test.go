@@ -0,0 +1,195 @@
+package creds
+
+import (
+	"strings"
+	"testing"
+)
+
+// useAliasedEnvironments has environments with aliases, and one whose name starts with another's
+func useAliasedEnvironments(t *testing.T) {
+	t.Helper()
+	saved := EnvironmentMap
+	t.Cleanup(func() { EnvironmentMap = saved })
+	EnvironmentMap = map[string]Environment{
+		"prod":    {Name: "prod", Aliases: []string{"prd", "production"}, DefaultQuality: "gamma", DefaultRole: "Auditor"},
+		"prod-eu": {Name: "prod-eu", Aliases: []string{"eu"}, DefaultQuality: "gamma", DefaultRole: "Auditor"},
+		"staging": {Name: "staging", Aliases: []string{"stg"}, DefaultQuality: "alpha", DefaultRole: "Administrator"},
+	}
+}
+
+func TestResolveEnvironment(t *testing.T) {
+	useAliasedEnvironments(t)
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"prod", "prod", true},
+		{"prd", "prod", true},
+		{"PRD", "prod", true},
+		{"production", "prod", true},
+		{"prod-eu", "prod-eu", true},
+		{"eu", "prod-eu", true},
+		{"stg", "staging", true},
+		{"dev", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := resolveEnvironment(tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("resolveEnvironment(%q) = %q, %t, want %q, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseProfile(t *testing.T) {
+	useAliasedEnvironments(t)
+	tests := []struct {
+		profile                            string
+		environment, domain, quality, role string
+		wantErr                            bool
+	}{
+		{profile: "prod-api", environment: "prod", domain: "api"},
+		{profile: "prd-api", environment: "prd", domain: "api"},
+		{profile: "prod-static-sites", environment: "prod", domain: "static-sites"},
+		{profile: "prd-static-sites", environment: "prd", domain: "static-sites"},
+		{profile: "stg-static-sites-v2", environment: "stg", domain: "static-sites-v2"},
+		// the longest environment prefix wins, so prod-eu isn't read as prod with an eu-api domain
+		{profile: "prod-eu-api", environment: "prod-eu", domain: "api"},
+		{profile: "production-api", environment: "production", domain: "api"},
+		{profile: "eu-static-sites", environment: "eu", domain: "static-sites"},
+		// an unknown environment is split at the first dash and left for NewRoleData to reject
+		{profile: "dev-static-sites", environment: "dev", domain: "static-sites"},
+		{profile: "prod/api", environment: "prod", domain: "api"},
+		{profile: "prd/static-sites/gamma", environment: "prd", domain: "static-sites", quality: "gamma"},
+		{profile: "prod-eu/api/gamma/Auditor", environment: "prod-eu", domain: "api", quality: "gamma", role: "Auditor"},
+		{profile: "prod", wantErr: true},
+		{profile: "prod-", wantErr: true},
+		{profile: "-api", wantErr: true},
+		{profile: "", wantErr: true},
+		{profile: "prod/", wantErr: true},
+		{profile: "/api", wantErr: true},
+		{profile: "prod//gamma", wantErr: true},
+		{profile: "prod/api/gamma/Auditor/extra", wantErr: true},
+	}
+	for _, tt := range tests {
+		environment, domain, quality, role, err := parseProfile(tt.profile)
+		if tt.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "invalid profile") {
+				t.Errorf("parseProfile(%q) error = %v, want invalid profile", tt.profile, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseProfile(%q): %s", tt.profile, err)
+			continue
+		}
+		if environment != tt.environment || domain != tt.domain || quality != tt.quality || role != tt.role {
+			t.Errorf("parseProfile(%q) = %q, %q, %q, %q, want %q, %q, %q, %q", tt.profile,
+				environment, domain, quality, role, tt.environment, tt.domain, tt.quality, tt.role)
+		}
+	}
+}
+
+func TestNewRoleDataResolvesAliases(t *testing.T) {
+	useAliasedEnvironments(t)
+	tests := []struct {
+		profile string
+		want    RoleData
+		wantErr string
+	}{
+		{profile: "prd-static-sites", want: RoleData{"prod", "static-sites", "gamma", "Auditor"}},
+		{profile: "eu-api", want: RoleData{"prod-eu", "api", "gamma", "Auditor"}},
+		{profile: "stg/lambda/beta", want: RoleData{"staging", "lambda", "beta", "Administrator"}},
+		{profile: "prodd-api", wantErr: `unknown environment "prodd", did you mean "prod"?`},
+		{profile: "sandbox-api", wantErr: `unknown environment "sandbox"`},
+	}
+	for _, tt := range tests {
+		environment, domain, quality, role, err := parseProfile(tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := NewRoleData(environment, domain, quality, role)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("%s: error = %v, want %s", tt.profile, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s resolved to %+v, %v, want %+v", tt.profile, got, err, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	useAliasedEnvironments(t)
+	tests := []struct {
+		name       string
+		candidates []string
+		want       string
+	}{
+		{"prodd", environmentNames(), `, did you mean "prod"?`},
+		{"PROD", environmentNames(), `, did you mean "prod"?`},
+		{"satging", environmentNames(), `, did you mean "staging"?`},
+		{"prod-ue", environmentNames(), `, did you mean "prod-eu"?`},
+		{"lamda", []string{"api", "lambda", "static-sites"}, `, did you mean "lambda"?`},
+		{"static-site", []string{"api", "lambda", "static-sites"}, `, did you mean "static-sites"?`},
+		{"xyz", environmentNames(), ""},
+		{"billing", []string{"api", "lambda"}, ""},
+		{"api", nil, ""},
+	}
+	for _, tt := range tests {
+		if got := suggest(tt.name, tt.candidates); got != tt.want {
+			t.Errorf("suggest(%q, %v) = %q, want %q", tt.name, tt.candidates, got, tt.want)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"prod", "prod", 0},
+		{"prod", "", 4},
+		{"", "stg", 3},
+		{"prod", "prd", 1},
+		{"prod", "podr", 2},
+		{"kitten", "sitting", 3},
+		{"staging", "satging", 2},
+		{"géant", "geant", 1},
+		{"日本", "日本語", 1},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := levenshtein(tt.b, tt.a); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		s, query string
+		want     bool
+	}{
+		{"static-sites", "stst", true},
+		{"static-sites", "static-sites", true},
+		{"static-sites", "", true},
+		{"static-sites", "sites-static", false},
+		{"api-prod", "dorp", false},
+		{"", "a", false},
+		{"café-prod", "éprd", true},
+		{"cafe-prod", "é", false},
+		{"日本-prod", "本p", true},
+	}
+	for _, tt := range tests {
+		if got := fuzzyMatch(tt.s, tt.query); got != tt.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %t, want %t", tt.s, tt.query, got, tt.want)
+		}
+	}
+}
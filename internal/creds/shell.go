@@ -0,0 +1,117 @@
+package creds
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-ps"
+)
+
+// maxShellSearchDepth bounds how far up the process tree getShell looks
+const maxShellSearchDepth = 8
+
+// shellAliases maps executable names to the shell names Credentials.Export understands.  dash, ash,
+// ksh and mksh get POSIX sh syntax, they have no export syntax of their own.
+var shellAliases = map[string]string{
+	"sh":         "sh",
+	"dash":       "sh",
+	"ash":        "sh",
+	"ksh":        "sh",
+	"mksh":       "sh",
+	"bash":       "bash",
+	"zsh":        "zsh",
+	"fish":       "fish",
+	"nu":         "nu",
+	"pwsh":       "pwsh",
+	"powershell": "pwsh",
+	"tcsh":       "tcsh",
+	"csh":        "csh",
+}
+
+// wrapperProcesses sit between the user's shell and quikstrate without changing the shell
+var wrapperProcesses = map[string]bool{
+	"go":       true,
+	"sudo":     true,
+	"doas":     true,
+	"su":       true,
+	"env":      true,
+	"nohup":    true,
+	"timeout":  true,
+	"time":     true,
+	"xargs":    true,
+	binaryName: true,
+}
+
+// getShell returns the shell that will evaluate our output, checked in order:
+//  1. the --shell flag (override)
+//  2. $QUIKSTRATE_SHELL
+//  3. the nearest shell in the parent process tree, skipping wrappers like go run, sudo and env
+//  4. $SHELL
+//  5. sh, ie. POSIX export syntax
+//
+// An unknown --shell or $QUIKSTRATE_SHELL is an error, detection itself never fails: an unknown
+// shell falls back to POSIX.
+func getShell(override string) (string, error) {
+	for _, candidate := range []string{override, os.Getenv("QUIKSTRATE_SHELL")} {
+		if candidate == "" {
+			continue
+		}
+		shell, ok := normalizeShell(candidate)
+		if !ok {
+			return "", fmt.Errorf("unknown shell %q, expected one of %s (dash, ash, ksh and mksh use sh syntax)", candidate, strings.Join(sortedKeys(shellAliases), ", "))
+		}
+		return shell, nil
+	}
+	if shell, ok := parentShell(); ok {
+		return shell, nil
+	}
+	if shell, ok := normalizeShell(os.Getenv("SHELL")); ok {
+		return shell, nil
+	}
+	return "sh", nil
+}
+
+// formatShell resolves the shell only for formats that print shell syntax, so eg. credential_process
+// (-f json) never walks the process tree.  An unknown --shell is an error either way.
+func formatShell(format, override string) (string, error) {
+	if format != "export" {
+		if _, ok := normalizeShell(override); override != "" && !ok {
+			return getShell(override)
+		}
+		return "", nil
+	}
+	return getShell(override)
+}
+
+// parentShell walks up the process tree until it finds a shell or a process that isn't a wrapper
+// (eg. an IDE or terminal emulator), in which case $SHELL is a better guess
+func parentShell() (string, bool) {
+	pid := os.Getppid()
+	for i := 0; i < maxShellSearchDepth && pid > 1; i++ {
+		process, err := ps.FindProcess(pid)
+		if err != nil || process == nil {
+			return "", false
+		}
+		if shell, ok := normalizeShell(process.Executable()); ok {
+			return shell, true
+		}
+		if !wrapperProcesses[executableName(process.Executable())] {
+			return "", false
+		}
+		pid = process.PPid()
+	}
+	return "", false
+}
+
+func normalizeShell(name string) (string, bool) {
+	shell, ok := shellAliases[executableName(name)]
+	return shell, ok
+}
+
+// executableName strips paths, the "-" login shells are prefixed with and Windows extensions
+func executableName(name string) string {
+	name = strings.TrimPrefix(filepath.Base(strings.TrimSpace(name)), "-")
+	return strings.TrimSuffix(strings.ToLower(name), ".exe")
+}
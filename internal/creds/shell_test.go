@@ -0,0 +1,58 @@
+package creds
+
+import "testing"
+
+func TestFormatShell(t *testing.T) {
+	t.Setenv("QUIKSTRATE_SHELL", "fish")
+	for _, format := range CredentialFormats {
+		got, err := formatShell(format, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if format == "export" && got != "fish" {
+			t.Errorf("formatShell(%q) = %q, want fish", format, got)
+		}
+		if format != "export" && got != "" {
+			t.Errorf("formatShell(%q) = %q, want no shell", format, got)
+		}
+	}
+}
+
+func TestGetShellOverride(t *testing.T) {
+	tests := []struct {
+		override string
+		want     string
+		wantErr  bool
+	}{
+		{"bash", "bash", false},
+		{"/usr/local/bin/fish", "fish", false},
+		{"-zsh", "zsh", false},
+		{"dash", "sh", false},
+		{"ksh", "sh", false},
+		{"powershell.exe", "pwsh", false},
+		{"cmd", "", true},
+		{"bsh", "", true},
+	}
+	for _, tt := range tests {
+		got, err := getShell(tt.override)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("getShell(%q) = %q, %v, want %q (error %v)", tt.override, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGetShellInvalidEnv(t *testing.T) {
+	t.Setenv("QUIKSTRATE_SHELL", "elvish")
+	if _, err := getShell(""); err == nil {
+		t.Error("getShell accepted an unknown $QUIKSTRATE_SHELL")
+	}
+	if got, err := getShell("bash"); got != "bash" || err != nil {
+		t.Errorf("--shell should win over $QUIKSTRATE_SHELL, got %q, %v", got, err)
+	}
+}
+
+func TestFormatShellRejectsUnknownOverride(t *testing.T) {
+	if _, err := formatShell("json", "elvish"); err == nil {
+		t.Error("formatShell accepted an unknown --shell for json")
+	}
+}
@@ -0,0 +1,307 @@
+package creds
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	plaintextBackend = "plaintext"
+	encryptedBackend = "encrypted"
+)
+
+// encryptedMagic prefixes every file written by the encrypted backend, anything
+// else is treated as a legacy plaintext cache
+var encryptedMagic = []byte("quikstrate:enc:v1\n")
+
+var (
+	cacheBackend      = getenv("QUIKSTRATE_CACHE_BACKEND", encryptedBackend)
+	cacheKeyFile      = getenv("QUIKSTRATE_CACHE_KEY_FILE", filepath.Join(CredsDir, "cache.key"))
+	cacheSaltFile     = filepath.Join(CredsDir, "cache.salt")
+	cachePassphrase   = os.Getenv("QUIKSTRATE_CACHE_PASSPHRASE_COMMAND")
+	cacheStore        = newCacheStore(cacheBackend)
+	errEncryptedCache = errors.New("cache file is encrypted, set QUIKSTRATE_CACHE_BACKEND=encrypted to read it")
+)
+
+// CacheStore reads and writes the files quikstrate caches in CredsDir
+type CacheStore interface {
+	Read(file string) ([]byte, error)
+	Write(file string, data []byte) error
+	Clean() error
+}
+
+func newCacheStore(backend string) CacheStore {
+	switch backend {
+	case plaintextBackend:
+		return plaintextStore{}
+	case encryptedBackend:
+		return &encryptedStore{
+			keyFile:           cacheKeyFile,
+			saltFile:          cacheSaltFile,
+			passphraseCommand: cachePassphrase,
+		}
+	default:
+		log.Printf("unknown cache backend %q, using %s", backend, encryptedBackend)
+		return newCacheStore(encryptedBackend)
+	}
+}
+
+// CleanCache removes all cached files (and any encryption key) for the configured backend
+func CleanCache() error {
+	return cacheStore.Clean()
+}
+
+// cleanCredsDir removes everything in CredsDir except the user's config and the audit logs
+func cleanCredsDir() error {
+	entries, err := os.ReadDir(CredsDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		file := filepath.Join(CredsDir, entry.Name())
+		if file == ConfigFile || file == auditFile || file == auditRotation() {
+			continue
+		}
+		if err := os.RemoveAll(file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type plaintextStore struct{}
+
+func (plaintextStore) Read(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, encryptedMagic) {
+		return nil, errEncryptedCache
+	}
+	return data, nil
+}
+
+func (plaintextStore) Write(file string, data []byte) error {
+	return writeCacheFile(file, data)
+}
+
+func (plaintextStore) Clean() error {
+	return cleanCredsDir()
+}
+
+// encryptedStore seals cache files with AES-GCM.  The key is either a random key
+// kept in its own 0600 file, or derived (scrypt) from the output of a passphrase command
+// such as "op read op://private/quikstrate/password"
+type encryptedStore struct {
+	keyFile           string
+	saltFile          string
+	passphraseCommand string
+	key               []byte
+	// readOnly stores neither create the key (or salt) nor migrate plaintext files, see readOnlyCacheStore
+	readOnly bool
+}
+
+// readOnlyCacheStore returns a store that only reads what is already on disk
+func readOnlyCacheStore(store CacheStore) CacheStore {
+	if s, ok := store.(*encryptedStore); ok {
+		readOnly := *s
+		readOnly.readOnly = true
+		return &readOnly
+	}
+	return store
+}
+
+func (s *encryptedStore) Read(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		if s.readOnly {
+			return data, nil
+		}
+		// legacy plaintext cache, migrate it in place
+		if err := s.Write(file, data); err != nil {
+			log.Printf("unable to encrypt %s: %s", file, err)
+		}
+		return data, nil
+	}
+
+	gcm, err := s.cipher()
+	if err != nil {
+		return nil, err
+	}
+	data = data[len(encryptedMagic):]
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s is truncated", file)
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt %s: %w", file, err)
+	}
+	return plain, nil
+}
+
+func (s *encryptedStore) Write(file string, data []byte) error {
+	if s.readOnly {
+		return fmt.Errorf("unable to write %s, the cache store is read only", file)
+	}
+	gcm, err := s.cipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.Write(encryptedMagic)
+	buf.Write(nonce)
+	buf.Write(gcm.Seal(nil, nonce, data, nil))
+	return writeCacheFile(file, buf.Bytes())
+}
+
+func (s *encryptedStore) Clean() error {
+	if err := cleanCredsDir(); err != nil {
+		return err
+	}
+	// the key file may live outside of CredsDir
+	if err := os.Remove(s.keyFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *encryptedStore) cipher() (cipher.AEAD, error) {
+	if s.key == nil {
+		key, err := s.loadKey()
+		if err != nil {
+			return nil, err
+		}
+		s.key = key
+	}
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *encryptedStore) loadKey() ([]byte, error) {
+	if s.passphraseCommand == "" {
+		return s.readSecret(s.keyFile, 32)
+	}
+
+	passphrase, err := exec.Command("sh", "-c", s.passphraseCommand).Output()
+	if err != nil {
+		return nil, fmt.Errorf("passphrase command failed: %w", err)
+	}
+	passphrase = bytes.TrimSpace(passphrase)
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase command returned an empty passphrase")
+	}
+	salt, err := s.readSecret(s.saltFile, 16)
+	if err != nil {
+		return nil, err
+	}
+	return scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+}
+
+func (s *encryptedStore) readSecret(file string, size int) ([]byte, error) {
+	if !s.readOnly {
+		return readOrCreateSecret(file, size)
+	}
+	secret, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%s doesn't exist yet, nothing has been encrypted", file)
+	}
+	if err == nil && len(secret) != size {
+		return nil, fmt.Errorf("%s is %d bytes, expected %d", file, len(secret), size)
+	}
+	return secret, err
+}
+
+// readOrCreateSecret returns the contents of file, generating size random bytes if it doesn't exist
+func readOrCreateSecret(file string, size int) ([]byte, error) {
+	secret, err := os.ReadFile(file)
+	if err == nil {
+		if len(secret) != size {
+			return nil, fmt.Errorf("%s is %d bytes, expected %d", file, len(secret), size)
+		}
+		return secret, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	secret = make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, secret); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return nil, err
+	}
+	// write then hard link so two processes racing to create the key never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".secret-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(secret); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Link(tmp.Name(), file); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return readOrCreateSecret(file, size)
+		}
+		return nil, err
+	}
+	return secret, nil
+}
+
+// writeCacheFile atomically replaces file so readers never see a partially written cache
+func writeCacheFile(file string, data []byte) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,40 @@
+package creds
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOnlyCacheStore(t *testing.T) {
+	dir := t.TempDir()
+	store := &encryptedStore{keyFile: filepath.Join(dir, "cache.key"), saltFile: filepath.Join(dir, "cache.salt")}
+	readOnly := readOnlyCacheStore(store)
+
+	plainFile := filepath.Join(dir, "credentials.json")
+	if err := os.WriteFile(plainFile, []byte(`{"AccessKeyId":"AKIA"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, err := readOnly.Read(plainFile)
+	if err != nil || string(data) != `{"AccessKeyId":"AKIA"}` {
+		t.Fatalf("Read(plaintext) = %q, %v", data, err)
+	}
+	if _, err := os.Stat(store.keyFile); !os.IsNotExist(err) {
+		t.Errorf("read only store created %s", store.keyFile)
+	}
+	if onDisk, _ := os.ReadFile(plainFile); string(onDisk) != `{"AccessKeyId":"AKIA"}` {
+		t.Errorf("read only store migrated %s", plainFile)
+	}
+	if err := readOnly.Write(plainFile, []byte("{}")); err == nil {
+		t.Error("read only store wrote a file")
+	}
+
+	// once the real store has encrypted something the read only one can decrypt it
+	encryptedFile := filepath.Join(dir, "accounts.json")
+	if err := store.Write(encryptedFile, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := readOnlyCacheStore(store).Read(encryptedFile); err != nil || string(data) != "secret" {
+		t.Errorf("Read(encrypted) = %q, %v", data, err)
+	}
+}
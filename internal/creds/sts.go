@@ -0,0 +1,102 @@
+package creds
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// role chaining (default credentials -> role) caps sessions at 1 hour
+const nativeAssumeDuration = 3600
+
+var (
+	// nativeAssume calls sts:AssumeRole directly instead of "substrate assume-role"
+	nativeAssume, _ = strconv.ParseBool(os.Getenv("QUIKSTRATE_NATIVE_ASSUME"))
+	// stsEndpoint overrides the STS endpoint, eg. a local stand-in for testing
+	stsEndpoint = os.Getenv("QUIKSTRATE_STS_ENDPOINT")
+
+	invalidSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+)
+
+// assumeRoleNative resolves the role ARN from the cached account list and assumes it with the
+// default credentials in the environment (see ensureAWSEnvSet)
+func assumeRoleNative(ctx context.Context, role RoleData) (Credentials, error) {
+	accountList, err := getAccountList()
+	if err != nil {
+		return Credentials{}, err
+	}
+	account, ok := accountList.Find(role.Environment, role.Domain, role.Quality)
+	if !ok {
+		return Credentials{}, fmt.Errorf("no account found for %s-%s-%s", role.Environment, role.Domain, role.Quality)
+	}
+
+	region := getenv("AWS_REGION", DefaultRegion)
+	client := sts.New(sts.Options{
+		Region: region,
+		Credentials: credentials.NewStaticCredentialsProvider(
+			os.Getenv("AWS_ACCESS_KEY_ID"),
+			os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			os.Getenv("AWS_SESSION_TOKEN"),
+		),
+	}, func(o *sts.Options) {
+		if stsEndpoint != "" {
+			o.BaseEndpoint = aws.String(stsEndpoint)
+		}
+	})
+
+	out, err := client.AssumeRole(ctx, &sts.AssumeRoleInput{
+		RoleArn:         aws.String(fmt.Sprintf("arn:%s:iam::%s:role/%s", partition(account, region), account.Id, role.Role)),
+		RoleSessionName: aws.String(sessionName()),
+		DurationSeconds: aws.Int32(nativeAssumeDuration),
+	})
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return Credentials{
+		AccessKeyId:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		Expiration:      aws.ToTime(out.Credentials.Expiration),
+		Version:         1,
+	}, nil
+}
+
+// partition is the account's AWS partition (aws, aws-us-gov or aws-cn), from the ARN substrate lists
+// it with or, failing that, the region
+func partition(account Account, region string) string {
+	if parsed, err := arn.Parse(account.Arn); err == nil {
+		return parsed.Partition
+	}
+	switch {
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	}
+	return "aws"
+}
+
+func sessionName() string {
+	name := binaryName
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	name = invalidSessionNameChars.ReplaceAllString(name, "")
+	if len(name) < 2 {
+		name = binaryName
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,133 @@
+package creds
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIANATIVE</AccessKeyId>
+      <SecretAccessKey>native-secret</SecretAccessKey>
+      <SessionToken>native-token</SessionToken>
+      <Expiration>2030-01-02T03:04:05Z</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>arn:aws:sts::111111111111:assumed-role/Auditor/jane</Arn>
+      <AssumedRoleId>AROA:jane</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+  <ResponseMetadata><RequestId>1</RequestId></ResponseMetadata>
+</AssumeRoleResponse>`
+
+const accessDeniedResponse = `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <Error><Type>Sender</Type><Code>AccessDenied</Code><Message>not authorized to perform: sts:AssumeRole</Message></Error>
+  <RequestId>1</RequestId>
+</ErrorResponse>`
+
+// useTestSTS points native assume at a stand-in STS, which records the AssumeRole requests
+func useTestSTS(t *testing.T, status int, body string) *[]url.Values {
+	t.Helper()
+	var requests []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("unparsable STS request: %s", err)
+		}
+		requests = append(requests, r.PostForm)
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	saved := stsEndpoint
+	t.Cleanup(func() { stsEndpoint = saved })
+	stsEndpoint = server.URL
+	nativeAssume = true
+	return &requests
+}
+
+func TestAssumeRoleNative(t *testing.T) {
+	tests := []struct {
+		name    string
+		arn     string
+		region  string
+		wantArn string
+	}{
+		{
+			name:    "commercial",
+			arn:     "arn:aws:organizations::000000000000:account/o-abc/111111111111",
+			region:  "us-west-2",
+			wantArn: "arn:aws:iam::111111111111:role/Auditor",
+		},
+		{
+			name:    "govcloud account",
+			arn:     "arn:aws-us-gov:organizations::000000000000:account/o-abc/111111111111",
+			region:  "us-gov-west-1",
+			wantArn: "arn:aws-us-gov:iam::111111111111:role/Auditor",
+		},
+		{name: "govcloud region", region: "us-gov-east-1", wantArn: "arn:aws-us-gov:iam::111111111111:role/Auditor"},
+		{name: "china region", region: "cn-north-1", wantArn: "arn:aws-cn:iam::111111111111:role/Auditor"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := useTestCredsDir(t)
+			fake.accounts[0].Arn = tt.arn
+			t.Setenv("AWS_REGION", tt.region)
+			requests := useTestSTS(t, http.StatusOK, assumeRoleResponse)
+
+			creds, err := getRoleCredentials(RoleData{"prod", "api", "gamma", "Auditor"}, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if creds.AccessKeyId != "ASIANATIVE" || creds.SecretAccessKey != "native-secret" || creds.SessionToken != "native-token" {
+				t.Errorf("credentials = %+v, want the STS ones", creds)
+			}
+			if fake.assumeRole != 0 {
+				t.Errorf("substrate assumed the role %d times", fake.assumeRole)
+			}
+			if len(*requests) != 1 {
+				t.Fatalf("STS got %d requests, want 1", len(*requests))
+			}
+			request := (*requests)[0]
+			want := url.Values{
+				"Action":          {"AssumeRole"},
+				"RoleArn":         {tt.wantArn},
+				"RoleSessionName": {sessionName()},
+				"DurationSeconds": {"3600"},
+			}
+			for key, value := range want {
+				if request.Get(key) != value[0] {
+					t.Errorf("%s = %q, want %q", key, request.Get(key), value[0])
+				}
+			}
+		})
+	}
+}
+
+func TestAssumeRoleNativeFallsBackToSubstrate(t *testing.T) {
+	fake := useTestCredsDir(t)
+	requests := useTestSTS(t, http.StatusForbidden, accessDeniedResponse)
+
+	creds, err := getRoleCredentials(RoleData{"prod", "api", "gamma", "Auditor"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) == 0 {
+		t.Error("STS was never called")
+	}
+	if creds.AccessKeyId != "AKIAROLE" || fake.assumeRole != 1 {
+		t.Errorf("credentials = %+v, assumeRole = %d, want substrate's", creds, fake.assumeRole)
+	}
+}
+
+func TestSessionName(t *testing.T) {
+	name := sessionName()
+	if len(name) < 2 || len(name) > 64 || invalidSessionNameChars.MatchString(name) {
+		t.Errorf("sessionName() = %q, not a valid RoleSessionName", name)
+	}
+}
@@ -0,0 +1,310 @@
+package creds
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+)
+
+var (
+	ErrSubstrateNotInstalled = errors.New("substrate is not installed")
+	ErrLoginRequired         = errors.New("substrate login required")
+	ErrUnknownAccount        = errors.New("unknown substrate account or role")
+	ErrSubstrateTimeout      = errors.New("substrate timed out")
+
+	// substrate's login prompt asks for a URL to be opened in a browser ("open <https://...> in your
+	// web browser to log in"), or points at its credential factory.  Docs links, deprecation notices
+	// and endpoints in error messages are not prompts.
+	urlRegex          = regexp.MustCompile(`https?://[^\s<>"']+`)
+	loginPromptRegex  = regexp.MustCompile(`(?i)\b(open|opening|visit|paste|go to|browse to)\b.*\b(browser|log ?in|sign ?in|authenticate)\b`)
+	loginURLPathRegex = regexp.MustCompile(`/credential-factory\b`)
+	// both are word bounded so eg. "not authorized to perform" isn't mistaken for "authorization required"
+	loginRequiredRegex  = regexp.MustCompile(`(?i)(\b(log ?in|authentication|authorization) required\b|\bnot logged in\b|\bplease (log ?in|authenticate)\b|\bExpiredToken\b|\b(session|token|credentials) (has |have |is |are )?expired\b|\bcredential[ -]factory\b)`)
+	unknownAccountRegex = regexp.MustCompile(`(?i)(\bAccessDenied\b|\bnot authorized to perform\b|\bno such (account|role|domain|environment|quality)\b|\b(account|role|domain|environment|quality) (not found|does not exist)\b|\bunknown (account|role|domain|environment|quality)\b|\bno account found\b)`)
+
+	DefaultSubstrateOptions = SubstrateOptions{
+		Timeout:      getenvDuration("QUIKSTRATE_SUBSTRATE_TIMEOUT", time.Minute),
+		LoginTimeout: getenvDuration("QUIKSTRATE_SUBSTRATE_LOGIN_TIMEOUT", 5*time.Minute),
+		Retries:      getenvInt("QUIKSTRATE_SUBSTRATE_RETRIES", 2),
+		Backoff:      time.Second,
+	}
+
+	substrate SubstrateClient = NewSubstrateClient(substrateBinary, DefaultSubstrateOptions)
+)
+
+// exit codes for failures a wrapping script (or credential_process) may want to handle
+const (
+	exitLoginRequired    = 3
+	exitSubstrateTimeout = 4
+)
+
+// SubstrateClient covers the substrate commands quikstrate depends on
+type SubstrateClient interface {
+	Credentials(ctx context.Context) (Credentials, error)
+	AssumeRole(ctx context.Context, role RoleData) (Credentials, error)
+	AccountList(ctx context.Context) ([]Account, error)
+	Version(ctx context.Context) (string, error)
+}
+
+// SubstrateError is returned for any failed substrate invocation.  errors.Is matches it against
+// ErrSubstrateNotInstalled, ErrLoginRequired, ErrUnknownAccount and ErrSubstrateTimeout.
+type SubstrateError struct {
+	Command  string
+	Kind     error
+	Stderr   string
+	LoginURL string
+	Err      error
+}
+
+func (e *SubstrateError) Error() string {
+	msg := fmt.Sprintf("%s: %s", e.Command, e.Err)
+	if e.Kind != nil {
+		msg = fmt.Sprintf("%s (%s)", msg, e.Kind)
+	}
+	return msg
+}
+
+func (e *SubstrateError) Unwrap() []error {
+	if e.Kind == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Kind, e.Err}
+}
+
+// SubstrateOptions bound how long (and how often) quikstrate waits on substrate
+type SubstrateOptions struct {
+	// Timeout for a single substrate invocation
+	Timeout time.Duration
+	// LoginTimeout replaces Timeout once substrate is waiting on an interactive login
+	LoginTimeout time.Duration
+	// Retries after a failed or timed out invocation, login and unknown account errors aren't retried
+	Retries int
+	// Backoff before the first retry, doubled for each retry after
+	Backoff time.Duration
+}
+
+// ConfigureSubstrate replaces the substrate client, eg. to point at a fake binary for testing
+func ConfigureSubstrate(binary string, options SubstrateOptions) {
+	substrateBinary = binary
+	substrate = NewSubstrateClient(binary, options)
+}
+
+// NewSubstrateClient returns a SubstrateClient that shells out to binary
+func NewSubstrateClient(binary string, options SubstrateOptions) SubstrateClient {
+	return &execSubstrateClient{binary: binary, options: options}
+}
+
+type execSubstrateClient struct {
+	binary  string
+	options SubstrateOptions
+}
+
+func (c *execSubstrateClient) Credentials(ctx context.Context) (creds Credentials, err error) {
+	err = c.runJSON(ctx, &creds, "credentials", "--format", "json", "--force")
+	return
+}
+
+func (c *execSubstrateClient) AssumeRole(ctx context.Context, role RoleData) (creds Credentials, err error) {
+	err = c.runJSON(ctx, &creds, "assume-role", "--environment", role.Environment, "--domain", role.Domain, "--quality", role.Quality, "--role", role.Role, "--format", "json")
+	return
+}
+
+func (c *execSubstrateClient) AccountList(ctx context.Context) (accounts []Account, err error) {
+	err = c.runJSON(ctx, &accounts, "account", "list", "--format", "json")
+	return
+}
+
+func (c *execSubstrateClient) Version(ctx context.Context) (string, error) {
+	out, err := c.run(ctx, "--version")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (c *execSubstrateClient) runJSON(ctx context.Context, v any, args ...string) error {
+	out, err := c.run(ctx, args...)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(out, v); err != nil {
+		return &SubstrateError{Command: c.command(args), Err: fmt.Errorf("unable to parse output: %w", err)}
+	}
+	return nil
+}
+
+// run returns the stdout of substrate, retrying transient failures with exponential backoff
+func (c *execSubstrateClient) run(ctx context.Context, args ...string) ([]byte, error) {
+	backoff := c.options.Backoff
+	for attempt := 0; ; attempt++ {
+		out, err := c.runOnce(ctx, args...)
+		if err == nil || attempt >= c.options.Retries || !retryable(err) {
+			return out, err
+		}
+		log.Printf("%s, retrying in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func retryable(err error) bool {
+	return !errors.Is(err, ErrSubstrateNotInstalled) && !errors.Is(err, ErrLoginRequired) && !errors.Is(err, ErrUnknownAccount)
+}
+
+// runOnce runs substrate with stderr passed through so prompts are still visible.  If substrate
+// prints a login URL it is surfaced; non-interactive callers (eg. credential_process) fail fast
+// instead of hanging, interactive callers get LoginTimeout to finish logging in.
+func (c *execSubstrateClient) runOnce(ctx context.Context, args ...string) ([]byte, error) {
+	command := c.command(args)
+	log.Print("running: ", command)
+
+	if _, err := exec.LookPath(c.binary); err != nil {
+		return nil, &SubstrateError{Command: command, Kind: ErrSubstrateNotInstalled, Err: err}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var timedOut, loginAborted atomic.Bool
+	timer := time.AfterFunc(c.options.Timeout, func() {
+		timedOut.Store(true)
+		cancel()
+	})
+	defer timer.Stop()
+
+	var loginURL string
+	watcher := &loginWatcher{onURL: func(url string) {
+		loginURL = url
+		log.Printf("substrate is waiting for you to log in, open: %s", url)
+		if !isInteractive() {
+			loginAborted.Store(true)
+			cancel()
+			return
+		}
+		timer.Reset(c.options.LoginTimeout)
+	}}
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.binary, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, watcher)
+	// don't wait on grandchildren holding stderr open after substrate is killed
+	cmd.WaitDelay = 2 * time.Second
+	err := cmd.Run()
+	if err == nil {
+		return stdout.Bytes(), nil
+	}
+
+	subErr := &SubstrateError{Command: command, Stderr: watcher.buf.String(), LoginURL: loginURL, Err: err}
+	switch {
+	case loginAborted.Load():
+		subErr.Kind = ErrLoginRequired
+	case timedOut.Load() && loginURL != "":
+		subErr.Kind = ErrLoginRequired
+	case timedOut.Load():
+		subErr.Kind = ErrSubstrateTimeout
+		subErr.Err = fmt.Errorf("no response after %s", c.options.Timeout)
+	default:
+		subErr.Kind = classifyStderr(subErr.Stderr)
+	}
+	return nil, subErr
+}
+
+// classifyStderr maps substrate's error output to ErrUnknownAccount or ErrLoginRequired, nil when it
+// is neither.  Access denied is checked first, a missing role must not send the user off to log in.
+func classifyStderr(stderr string) error {
+	switch {
+	case unknownAccountRegex.MatchString(stderr):
+		return ErrUnknownAccount
+	case loginRequiredRegex.MatchString(stderr):
+		return ErrLoginRequired
+	}
+	return nil
+}
+
+// loginWatcher buffers substrate's stderr and calls onURL the first time a line is a login prompt
+type loginWatcher struct {
+	buf     bytes.Buffer
+	scanned int
+	found   bool
+	onURL   func(url string)
+}
+
+func (w *loginWatcher) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	// only complete lines, so the whole URL has been received
+	for !w.found {
+		line, _, ok := bytes.Cut(w.buf.Bytes()[w.scanned:], []byte("\n"))
+		if !ok {
+			break
+		}
+		w.scanned += len(line) + 1
+		if url, ok := loginPromptURL(string(line)); ok {
+			w.found = true
+			w.onURL(url)
+		}
+	}
+	return len(p), nil
+}
+
+// loginPromptURL returns the URL in line when line is substrate asking the user to log in
+func loginPromptURL(line string) (string, bool) {
+	url := urlRegex.FindString(line)
+	if url == "" {
+		return "", false
+	}
+	url = strings.TrimRight(url, ".,;:)")
+	if loginURLPathRegex.MatchString(url) || loginPromptRegex.MatchString(urlRegex.ReplaceAllString(line, "URL")) {
+		return url, true
+	}
+	return "", false
+}
+
+// isInteractive is true when a person is watching stderr and can answer prompts, a var for tests
+var isInteractive = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+func (c *execSubstrateClient) command(args []string) string {
+	return strings.Join(append([]string{c.binary}, args...), " ")
+}
+
+// exitOnError logs err, with a hint for the substrate failures we know how to fix, and exits
+func exitOnError(err error) {
+	switch {
+	case errors.Is(err, ErrSubstrateNotInstalled):
+		log.Fatalf("%s\nInstall it with \"brew install metronome-industries/metronome/substrate-tools\" or set QUIKSTRATE_SUBSTRATE_BINARY / --substrate-binary", err)
+	case errors.Is(err, ErrLoginRequired):
+		log.Printf("%s\nRun \"substrate credentials\" to log in, then try again", err)
+		var subErr *SubstrateError
+		if errors.As(err, &subErr) && subErr.LoginURL != "" {
+			log.Printf("or open: %s", subErr.LoginURL)
+		}
+		os.Exit(exitLoginRequired)
+	case errors.Is(err, ErrUnknownAccount):
+		log.Fatalf("%s\nCheck the environment, domain, quality and role against \"%s accounts\"", err, binaryName)
+	case errors.Is(err, ErrBreakGlassRequired):
+		log.Print(err)
+		os.Exit(exitBreakGlassRequired)
+	case errors.Is(err, ErrSubstrateTimeout):
+		log.Printf("%s\nsubstrate didn't respond, check your network connection or raise --substrate-timeout", err)
+		os.Exit(exitSubstrateTimeout)
+	default:
+		log.Fatal(err)
+	}
+}
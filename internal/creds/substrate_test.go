@@ -0,0 +1,109 @@
+package creds
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestClassifyStderr(t *testing.T) {
+	tests := []struct {
+		name   string
+		stderr string
+		want   error
+	}{
+		{
+			"access denied",
+			"operation error STS: AssumeRole, https response error StatusCode: 403, RequestID: 0a1b, api error AccessDenied: User: arn:aws:sts::111111111111:assumed-role/Administrator/jane is not authorized to perform: sts:AssumeRole on resource: arn:aws:iam::222222222222:role/Administrator\n",
+			ErrUnknownAccount,
+		},
+		{
+			"not authorized without AccessDenied",
+			"jane is not authorized to perform: sts:AssumeRole on resource: arn:aws:iam::222222222222:role/Auditor\n",
+			ErrUnknownAccount,
+		},
+		{
+			"no account",
+			"no account found with tags Environment=prod Domain=billing Quality=gamma\n",
+			ErrUnknownAccount,
+		},
+		{
+			"expired token",
+			"operation error STS: GetCallerIdentity, https response error StatusCode: 403, RequestID: 0a1b, api error ExpiredToken: The security token included in the request is expired\n",
+			ErrLoginRequired,
+		},
+		{
+			"credential factory",
+			"credential factory request failed, run substrate credentials\n",
+			ErrLoginRequired,
+		},
+		{
+			"authorization required",
+			"Intranet responded 401 Unauthorized: authorization required\n",
+			ErrLoginRequired,
+		},
+		{
+			"session expired",
+			"your session has expired, please log in again\n",
+			ErrLoginRequired,
+		},
+		{
+			"network failure",
+			"dial tcp: lookup sts.amazonaws.com: no such host\n",
+			nil,
+		},
+		{
+			"throttled",
+			"api error Throttling: Rate exceeded\n",
+			nil,
+		},
+		{
+			"login url in docs link",
+			"see https://docs.src-bin.com/substrate/login for details about authorizing\n",
+			nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyStderr(tt.stderr); !errors.Is(got, tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("classifyStderr(%q) = %v, want %v", tt.stderr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginPromptURL(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"open <https://intranet.example.com/credential-factory/authorize?state=abc> in your web browser to log in", "https://intranet.example.com/credential-factory/authorize?state=abc"},
+		{"opening https://intranet.example.com/login?next=%2F in your web browser", "https://intranet.example.com/login?next=%2F"},
+		{"https://intranet.example.com/credential-factory/fetch", "https://intranet.example.com/credential-factory/fetch"},
+		{"see https://docs.src-bin.com/substrate/ for the release notes", ""},
+		{"substrate 2024.01 is deprecated, upgrade to log in with SSO: https://docs.src-bin.com/substrate/upgrading", ""},
+		{"operation error STS: AssumeRole, Post \"https://sts.us-west-2.amazonaws.com/\": dial tcp: i/o timeout", ""},
+		{"no URL here, please log in", ""},
+	}
+	for _, tt := range tests {
+		got, ok := loginPromptURL(tt.line)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("loginPromptURL(%q) = %q, %v, want %q", tt.line, got, ok, tt.want)
+		}
+	}
+}
+
+func TestLoginWatcherWaitsForCompleteLines(t *testing.T) {
+	var urls []string
+	w := &loginWatcher{onURL: func(url string) { urls = append(urls, url) }}
+	for _, chunk := range []string{
+		"see https://docs.src-bin.com/substrate/ for details\n",
+		"open https://intranet.example.com/credential-",
+		"factory/authorize in your web browser\n",
+		"open https://intranet.example.com/credential-factory/again in your web browser\n",
+	} {
+		w.Write([]byte(chunk))
+	}
+	if len(urls) != 1 || urls[0] != "https://intranet.example.com/credential-factory/authorize" {
+		t.Errorf("onURL called with %q", urls)
+	}
+}
@@ -0,0 +1,126 @@
+package creds
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// AccountExports are the accounts --export values
+var AccountExports = []string{"extend-switch-roles", "bookmarks"}
+
+var hexColor = regexp.MustCompile(`^[0-9a-fA-F]{6}$`)
+
+// SwitchRoleName is the switch-role display name, the AWS_PROFILE with the quality appended when
+// it isn't the environment's default (the console truncates it at 64 characters)
+func (a Account) SwitchRoleName() string {
+	name := a.Profile()
+	if quality := a.Tags["Quality"]; quality != "" && quality != EnvironmentMap[a.Tags["Environment"]].DefaultQuality {
+		name += "-" + quality
+	}
+	return name
+}
+
+// SwitchRoleURL switches the console (console.switch_role_url) into the environment's default role, no
+// credentials needed.  Empty for unmanaged accounts.
+func (a Account) SwitchRoleURL() string {
+	env, ok := EnvironmentMap[a.Tags["Environment"]]
+	if !ok || env.DefaultRole == "" {
+		return ""
+	}
+	query := url.Values{
+		"account":     {a.Id},
+		"roleName":    {env.DefaultRole},
+		"displayName": {a.SwitchRoleName()},
+	}
+	if env.Color != "" {
+		query.Set("color", strings.ToUpper(env.Color))
+	}
+	return Settings.Console.SwitchRoleURL + "?" + query.Encode()
+}
+
+// switchRoleAccounts are the accounts a switch-role can be built for, sorted by environment then name
+func (a AccountList) switchRoleAccounts() []Account {
+	var accounts []Account
+	for _, account := range a.Accounts {
+		if account.SwitchRoleURL() != "" {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		if accounts[i].Tags["Environment"] != accounts[j].Tags["Environment"] {
+			return accounts[i].Tags["Environment"] < accounts[j].Tags["Environment"]
+		}
+		return accounts[i].SwitchRoleName() < accounts[j].SwitchRoleName()
+	})
+	return accounts
+}
+
+// Export writes the accounts in one of AccountExports
+func (a AccountList) Export(w io.Writer, format string) error {
+	switch format {
+	case "extend-switch-roles":
+		return a.writeExtendSwitchRoles(w)
+	case "bookmarks":
+		return a.writeBookmarks(w)
+	}
+	return fmt.Errorf("export %s is unsupported, expected one of %s", format, strings.Join(AccountExports, ", "))
+}
+
+// writeExtendSwitchRoles writes the config of the AWS Extend Switch Roles browser extension, see
+// https://github.com/tilfinltd/aws-extend-switch-roles#configuration
+func (a AccountList) writeExtendSwitchRoles(w io.Writer) error {
+	for _, account := range a.switchRoleAccounts() {
+		env := EnvironmentMap[account.Tags["Environment"]]
+		fmt.Fprintf(w, "[%s]\n", account.SwitchRoleName())
+		fmt.Fprintf(w, "aws_account_id = %s\n", account.Id)
+		fmt.Fprintf(w, "role_name = %s\n", env.DefaultRole)
+		if env.Color != "" {
+			fmt.Fprintf(w, "color = %s\n", strings.ToLower(env.Color))
+		}
+		if _, err := fmt.Fprintf(w, "region = %s\n\n", DefaultRegion); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var bookmarksTemplate = template.Must(template.New("bookmarks").Parse(`<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3>AWS</H3>
+    <DL><p>
+{{- range .}}
+        <DT><H3>{{.Environment}}</H3>
+        <DL><p>
+{{- range .Accounts}}
+            <DT><A HREF="{{.SwitchRoleURL}}">{{.SwitchRoleName}} ({{.Id}})</A>
+{{- end}}
+        </DL><p>
+{{- end}}
+    </DL><p>
+</DL><p>
+`))
+
+// writeBookmarks writes a Netscape bookmarks file, importable by every browser, with a folder per environment
+func (a AccountList) writeBookmarks(w io.Writer) error {
+	type folder struct {
+		Environment string
+		Accounts    []Account
+	}
+	var folders []folder
+	for _, account := range a.switchRoleAccounts() {
+		env := account.Tags["Environment"]
+		if len(folders) == 0 || folders[len(folders)-1].Environment != env {
+			folders = append(folders, folder{Environment: env})
+		}
+		folders[len(folders)-1].Accounts = append(folders[len(folders)-1].Accounts, account)
+	}
+	return bookmarksTemplate.Execute(w, folders)
+}
@@ -0,0 +1,109 @@
+package creds
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// useTestEnvironments has prod (Auditor, colored) and staging (no default role) environments
+func useTestEnvironments(t *testing.T) {
+	t.Helper()
+	saved := EnvironmentMap
+	t.Cleanup(func() { EnvironmentMap = saved })
+	EnvironmentMap = map[string]Environment{
+		"prod":    {Name: "prod", DefaultQuality: "gamma", DefaultRole: "Auditor", Color: "f2b0a9"},
+		"staging": {Name: "staging", DefaultQuality: "alpha"},
+	}
+}
+
+func switchRoleAccounts() AccountList {
+	return AccountList{Accounts: []Account{
+		{Id: "333333333333", Name: "api-prod-delta", Tags: map[string]string{"Environment": "prod", "Domain": "api", "Quality": "delta"}},
+		{Id: "111111111111", Name: "api-prod", Tags: map[string]string{"Environment": "prod", "Domain": "api", "Quality": "gamma"}},
+		{Id: "222222222222", Name: "api-staging", Tags: map[string]string{"Environment": "staging", "Domain": "api", "Quality": "alpha"}},
+		{Id: "444444444444", Name: "management"},
+	}}
+}
+
+func TestSwitchRoleURL(t *testing.T) {
+	useTestEnvironments(t)
+	tests := []struct {
+		name          string
+		switchRoleURL string
+		account       Account
+		want          string
+	}{
+		{
+			name:          "commercial",
+			switchRoleURL: DefaultSwitchRoleURL,
+			account:       switchRoleAccounts().Accounts[1],
+			want:          "https://signin.aws.amazon.com/switchrole?account=111111111111&color=F2B0A9&displayName=prod-api&roleName=Auditor",
+		},
+		{
+			name:          "govcloud",
+			switchRoleURL: "https://signin.amazonaws-us-gov.com/switchrole",
+			account:       switchRoleAccounts().Accounts[0],
+			want:          "https://signin.amazonaws-us-gov.com/switchrole?account=333333333333&color=F2B0A9&displayName=prod-api-delta&roleName=Auditor",
+		},
+		{name: "no default role", switchRoleURL: DefaultSwitchRoleURL, account: switchRoleAccounts().Accounts[2]},
+		{name: "unmanaged", switchRoleURL: DefaultSwitchRoleURL, account: switchRoleAccounts().Accounts[3]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useConsoleConfig(t, ConsoleConfig{SwitchRoleURL: tt.switchRoleURL})
+			if got := tt.account.SwitchRoleURL(); got != tt.want {
+				t.Errorf("SwitchRoleURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExport(t *testing.T) {
+	useTestEnvironments(t)
+	useConsoleConfig(t, ConsoleConfig{SwitchRoleURL: DefaultSwitchRoleURL})
+	accounts := switchRoleAccounts()
+
+	var buf bytes.Buffer
+	if err := accounts.Export(&buf, "extend-switch-roles"); err != nil {
+		t.Fatal(err)
+	}
+	want := `[prod-api]
+aws_account_id = 111111111111
+role_name = Auditor
+color = f2b0a9
+region = ` + DefaultRegion + `
+
+[prod-api-delta]
+aws_account_id = 333333333333
+role_name = Auditor
+color = f2b0a9
+region = ` + DefaultRegion + `
+
+`
+	if buf.String() != want {
+		t.Errorf("extend-switch-roles =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := accounts.Export(&buf, "bookmarks"); err != nil {
+		t.Fatal(err)
+	}
+	link := url.Values{"account": {"111111111111"}, "color": {"F2B0A9"}, "displayName": {"prod-api"}, "roleName": {"Auditor"}}
+	for _, want := range []string{
+		"<DT><H3>prod</H3>",
+		`<A HREF="` + DefaultSwitchRoleURL + "?" + strings.ReplaceAll(link.Encode(), "&", "&amp;") + `">prod-api (111111111111)</A>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("bookmarks are missing %s:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "staging") || strings.Contains(buf.String(), "management") {
+		t.Errorf("bookmarks include accounts without a switch-role:\n%s", buf.String())
+	}
+
+	if err := accounts.Export(&buf, "csv"); err == nil {
+		t.Error("Export(csv) succeeded")
+	}
+}
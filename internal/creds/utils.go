@@ -5,10 +5,10 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/bitfield/script"
-	"github.com/mitchellh/go-ps"
 	"github.com/spf13/cobra"
 )
 
@@ -16,18 +16,22 @@ var (
 	home, _          = os.UserHomeDir()
 	CredsDir         = filepath.Join(home, fmt.Sprintf("/.%s", binaryName))
 	DefaultCredsFile = filepath.Join(CredsDir, "credentials.json")
+	DefaultRegion    = "us-west-2"
+	substrateBinary  = getenv("QUIKSTRATE_SUBSTRATE_BINARY", "substrate")
 	EnvironmentMap   = map[string]Environment{
 		"staging": {
 			Name:           "staging",
 			Aliases:        []string{"staging", "stg"},
 			DefaultQuality: "alpha",
 			DefaultRole:    "Administrator",
+			Color:          "fad791",
 		},
 		"prod": {
 			Name:           "prod",
 			Aliases:        []string{"production", "prod", "prd"},
 			DefaultQuality: "gamma",
 			DefaultRole:    "Auditor",
+			Color:          "f2b0a9",
 		},
 	}
 	Domains  = []string{"api", "auth", "druid", "graphql", "ingest", "lakehouse", "lambda", "marketplaces", "notifications", "static-sites"}
@@ -48,15 +52,17 @@ var (
 )
 
 type ClusterSpec struct {
-	Name   string
-	Domain string
+	Name   string `json:"name"`
+	Domain string `json:"domain"`
 }
 
 type Environment struct {
-	Name           string
-	Aliases        []string
-	DefaultQuality string
-	DefaultRole    string
+	Name           string   `json:"-"`
+	Aliases        []string `json:"aliases,omitempty"`
+	DefaultQuality string   `json:"default_quality,omitempty"`
+	DefaultRole    string   `json:"default_role,omitempty"`
+	// Color is the console switch-role color, a hex RGB value like f2b0a9
+	Color string `json:"color,omitempty"`
 }
 
 type RoleData struct {
@@ -70,28 +76,58 @@ func (r RoleData) GetFilename() string {
 	return filepath.Join(CredsDir, strings.ToLower(fmt.Sprintf("%s-%s-%s-%s.json", r.Environment, r.Domain, r.Quality, r.Role)))
 }
 
+// Profile matches the AWS_PROFILE names written by configure
+func (r RoleData) Profile() string {
+	return fmt.Sprintf("%s-%s", r.Environment, r.Domain)
+}
+
 func ensureAWSEnvSet() {
 	if os.Getenv("AWS_ACCESS_KEY_ID") == "" || os.Getenv("AWS_SECRET_ACCESS_KEY") == "" || os.Getenv("AWS_SESSION_TOKEN") == "" {
 		log.Fatal("AWS credentials not set")
 	}
 }
 
+// RootPreRunCmd applies the persistent flags shared by every command
+func RootPreRunCmd(cmd *cobra.Command, args []string) {
+	if configErr != nil {
+		log.Fatal(configErr)
+	}
+	binary := cmd.Flag("substrate-binary").Value.String()
+	if binary == "" {
+		binary = substrateBinary
+	}
+	options := DefaultSubstrateOptions
+	options.Timeout, _ = cmd.Flags().GetDuration("substrate-timeout")
+	options.Retries, _ = cmd.Flags().GetInt("substrate-retries")
+	ConfigureSubstrate(binary, options)
+}
+
 func PreRunCmd(cmd *cobra.Command, args []string) {
-	script.Exec(fmt.Sprintf("mkdir -p %s", CredsDir)).Wait()
+	if err := os.MkdirAll(CredsDir, 0700); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func getenv(key, fallback string) string {
+	value := os.Getenv(key)
+	if len(value) == 0 {
+		return fallback
+	}
+	return value
 }
 
-func getProcess(ppid int) ps.Process {
-	process, err := ps.FindProcess(ppid)
+func getenvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
 	if err != nil {
-		log.Fatal(err)
+		return fallback
 	}
-	return process
+	return value
 }
 
-func getShell() string {
-	parent := getProcess(os.Getppid())
-	if parent.Executable() == "go" {
-		parent = getProcess(parent.PPid())
+func getenvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
 	}
-	return parent.Executable()
+	return value
 }